@@ -1,8 +1,10 @@
 package attributes
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jpincas/go-tea/css"
 )
@@ -1363,3 +1365,111 @@ func Kind(s string) Attribute {
 func Srclang(s string) Attribute {
 	return regularAttribute(srclang, s)
 }
+
+// =============================================================================
+// Attribute Constructors - Go-Tea
+// =============================================================================
+// These attributes are read by gotea.js, rather than by the browser
+
+const (
+	goteaHook           = "data-gotea-hook"
+	goteaLoadingClass   = "data-gotea-loading-class"
+	goteaLoadingDisable = "data-gotea-loading-disable"
+	goteaConnectionShow = "data-gotea-connection-show"
+	goteaMorph          = "data-gotea-morph"
+	goteaKey            = "data-gotea-key"
+	goteaEnter          = "data-gotea-enter"
+	goteaLeave          = "data-gotea-leave"
+)
+
+// Connection statuses, as shown by gotea.js
+const (
+	ConnectionConnecting   = "connecting"
+	ConnectionConnected    = "connected"
+	ConnectionReconnecting = "reconnecting"
+	ConnectionDisconnected = "disconnected"
+)
+
+// Morph policies, which control how gotea.js updates an element when the server renders it
+const (
+	// MorphIgnoreValue keeps whatever the user has entered in the field, even when it isn't focused
+	MorphIgnoreValue = "ignore-value"
+	// MorphIgnoreChildren leaves the element's children as they are
+	MorphIgnoreChildren = "ignore-children"
+	// MorphIgnoreAttributes leaves the element's attributes as they are
+	MorphIgnoreAttributes = "ignore-attributes"
+	// MorphForce gives the field the rendered value, even while the user is typing in it
+	MorphForce = "force"
+)
+
+// Hook attaches the client-side hook registered with gotea.registerHook(name, {...}) to the element.
+// The element should have an ID.  Its attributes are kept up to date with the server,
+// but its children belong to the hook, so morphdom leaves them alone.
+func Hook(name string) Attribute {
+	return regularAttribute(goteaHook, name)
+}
+
+// Key identifies the element among the items of a list, so that when the list is reordered,
+// gotea.js moves the element rather than rebuilding it, and it keeps its state and transitions.
+// Keys need only be unique within the nearest ancestor with an ID, so give the list container one.
+func Key(key string) Attribute {
+	return regularAttribute(goteaKey, key)
+}
+
+// Transition is a CSS transition which gotea.js runs when a render adds or removes an element.
+// For the whole of Duration, the element has the Active classes, which should declare the transition itself.
+// It starts with the From classes, which are swapped for the To classes on the next frame, e.g.
+// Transition{Active: "transition-opacity duration-300", From: "opacity-0", To: "opacity-100", Duration: 300 * time.Millisecond}
+type Transition struct {
+	Active   string
+	From     string
+	To       string
+	Duration time.Duration
+}
+
+func (t Transition) attribute(name string) Attribute {
+	jsonTransition, _ := json.Marshal(map[string]any{
+		"active":   t.Active,
+		"from":     t.From,
+		"to":       t.To,
+		"duration": t.Duration.Milliseconds(),
+	})
+	return regularAttributeWithSingleQuotes(name, strings.ReplaceAll(string(jsonTransition), "'", `\u0027`))
+}
+
+// Enter runs the transition when a render adds the element to the page.
+// It doesn't run for elements on the page as it was first served.
+func Enter(t Transition) Attribute {
+	return t.attribute(goteaEnter)
+}
+
+// Leave runs the transition when a render removes the element, which stays on the page until it has finished.
+// Meanwhile, renders leave the element alone.  Key the items of a list, or removing one from the middle
+// morphs the rest into each other and the last one leaves instead.
+func Leave(t Transition) Attribute {
+	return t.attribute(goteaLeave)
+}
+
+// Morph sets the policies gotea.js follows when it updates the element after a render,
+// e.g. Morph(MorphIgnoreValue).  Without a policy, the focused field keeps the value the user is typing.
+func Morph(policies ...string) Attribute {
+	return regularAttribute(goteaMorph, strings.Join(policies, " "))
+}
+
+// LoadingClass sets the classes added to the element while a message it sent is in flight,
+// in place of the default gotea-loading.  The element also gets aria-busy="true" meanwhile.
+func LoadingClass(s string) Attribute {
+	return regularAttribute(goteaLoadingClass, s)
+}
+
+// DisableWhileLoading disables the element while a message it sent is in flight,
+// so e.g. a slow form can't be submitted twice
+func DisableWhileLoading(b bool) Attribute {
+	return booleanAttribute(goteaLoadingDisable, b)
+}
+
+// ShowOnConnection makes gotea.js show the element only while the connection status is one of those listed,
+// and hide it otherwise.  Render it with Hidden(true), so it doesn't show before gotea.js has connected.
+func ShowOnConnection(statuses ...string) Attribute {
+	return regularAttribute(goteaConnectionShow, strings.Join(statuses, " "))
+}
@@ -0,0 +1,142 @@
+package gotea
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	a "github.com/jpincas/go-tea/attributes"
+)
+
+// BINDINGS
+
+// Bindings are the declarative alternative to the JS strings built by SendMessage and friends.
+// Rather than an inline handler such as onclick="gotea.sendMessage({...})", a binding renders as
+// data-gotea-click='{...}', and gotea.js handles it with a listener on the document.
+// Pages built only with bindings run under a Content-Security-Policy which forbids 'unsafe-inline'.
+//
+// Everything the string helpers do is available: values from inputs and forms,
+// event payloads, key filters, and debouncing and throttling.
+
+// bindingAttributePrefix is followed by the event name, e.g. data-gotea-click
+const bindingAttributePrefix = "data-gotea-"
+
+// Binding describes the message to send when an event fires
+type Binding struct {
+	spec bindingSpec
+}
+
+// bindingSpec is the JSON read by gotea.js.  The message's own fields are at the top level,
+// so the attribute reads like the message it sends.
+type bindingSpec struct {
+	Message
+	Input     string       `json:"input,omitempty"`
+	ThisInput bool         `json:"thisInput,omitempty"`
+	Form      string       `json:"form,omitempty"`
+	Fields    []EventField `json:"fields,omitempty"`
+	Key       string       `json:"key,omitempty"`
+	Debounce  int64        `json:"debounce,omitempty"`
+	Throttle  int64        `json:"throttle,omitempty"`
+	Ops       []jsOp       `json:"ops,omitempty"`
+}
+
+// Send is a binding which sends the message
+func Send(m Message) Binding {
+	return Binding{spec: bindingSpec{Message: m}}
+}
+
+// SendBasic is a binding which sends a message with the arguments
+func SendBasic(msg string, args any) Binding {
+	return Send(Message{Message: msg, Arguments: args})
+}
+
+// SendWithValueFromInput is a binding which sends the message with the value of the input as its arguments
+func SendWithValueFromInput(m Message, inputID string) Binding {
+	b := Send(m)
+	b.spec.Input = inputID
+	return b
+}
+
+// SendWithValueFromThisInput is a binding which sends the message with the value of the bound element
+func SendWithValueFromThisInput(m Message) Binding {
+	b := Send(m)
+	b.spec.ThisInput = true
+	return b
+}
+
+// SendForm is a binding which sends the message with the serialised form as its arguments
+func SendForm(m Message, formID string) Binding {
+	b := Send(m)
+	b.spec.Form = formID
+	return b
+}
+
+// WithEvent sends the selected properties of the event with the message, like SendMessageWithEvent
+func (b Binding) WithEvent(fields ...EventField) Binding {
+	b.spec.Fields = appendCopy(b.spec.Fields, fields...)
+	return b
+}
+
+// OnKey only sends the message for the key, like OnKey
+func (b Binding) OnKey(key string) Binding {
+	b.spec.Key = key
+	return b
+}
+
+// Debounce holds the message back until the event has stopped firing for the delay, like Debounce
+func (b Binding) Debounce(delay time.Duration) Binding {
+	b.spec.Debounce = delay.Milliseconds()
+	b.spec.Throttle = 0
+	return b
+}
+
+// Throttle sends the message at most once per delay, like Throttle
+func (b Binding) Throttle(delay time.Duration) Binding {
+	b.spec.Throttle = delay.Milliseconds()
+	b.spec.Debounce = 0
+	return b
+}
+
+// String returns the JSON gotea.js reads from the attribute
+func (b Binding) String() string {
+	jsonSpec, _ := json.Marshal(b.spec)
+	return escapeSingleQuotes(jsonSpec)
+}
+
+// escapeSingleQuotes escapes JSON for a single quoted attribute, so quotes in arguments don't end it
+func escapeSingleQuotes(jsonData []byte) string {
+	return strings.ReplaceAll(string(jsonData), "'", `\u0027`)
+}
+
+// Bind renders the binding as an attribute, which sends the message when the event fires on the element.
+// Events bubble as usual, so a binding on a container also fires for events on its children.
+func Bind(event string, b Binding) a.Attribute {
+	return a.Attribute{Name: bindingAttributePrefix + event, Val: b.String(), RenderWithSingleQuotes: true}
+}
+
+// Shortcuts for the common events
+
+func BindClick(b Binding) a.Attribute {
+	return Bind("click", b)
+}
+
+func BindInput(b Binding) a.Attribute {
+	return Bind("input", b)
+}
+
+func BindChange(b Binding) a.Attribute {
+	return Bind("change", b)
+}
+
+// BindSubmit prevents the browser submitting the form itself
+func BindSubmit(b Binding) a.Attribute {
+	return Bind("submit", b)
+}
+
+func BindKeydown(b Binding) a.Attribute {
+	return Bind("keydown", b)
+}
+
+func BindKeyUp(b Binding) a.Attribute {
+	return Bind("keyup", b)
+}
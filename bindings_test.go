@@ -0,0 +1,48 @@
+package gotea
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBindings(t *testing.T) {
+	component := ComponentID("SELECTOR")
+
+	testCases := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			"basic",
+			BindClick(SendBasic("SELECT", "a")).String(),
+			`data-gotea-click='{"message":"SELECT","args":"a","identifier":"","blockRerender":false}'`,
+		},
+		{
+			"quotes in arguments are escaped",
+			BindClick(SendBasic("SELECT", "it's")).String(),
+			`data-gotea-click='{"message":"SELECT","args":"it\u0027s","identifier":"","blockRerender":false}'`,
+		},
+		{
+			"component input with debounce",
+			BindKeyUp(component.SendWithValueFromInput("SEARCH", "search-input").Debounce(200 * time.Millisecond)).String(),
+			`data-gotea-keyup='{"message":"SELECTOR_SEARCH","args":null,"identifier":"","blockRerender":false,"componentId":"SELECTOR","input":"search-input","debounce":200}'`,
+		},
+		{
+			"key filter and event fields",
+			BindKeydown(Send(Message{Message: "MOVE"}).OnKey("ArrowUp").WithEvent(EventModifiers)).String(),
+			`data-gotea-keydown='{"message":"MOVE","args":null,"identifier":"","blockRerender":false,"fields":["modifiers"],"key":"ArrowUp"}'`,
+		},
+		{
+			"throttle replaces debounce",
+			Bind("mousemove", SendBasic("TRACK", nil).Debounce(time.Second).Throttle(50*time.Millisecond)).String(),
+			`data-gotea-mousemove='{"message":"TRACK","args":null,"identifier":"","blockRerender":false,"throttle":50}'`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if testCase.output != testCase.expected {
+			t.Errorf("Test '%s' failed. Expected %s, got %s", testCase.name, testCase.expected, testCase.output)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package gotea
+
+// CALLS
+
+// gotea.call(message, args) sends a message from JS and returns a Promise, which resolves
+// with the reply from the handler, or rejects if the handler fails or doesn't reply in time.
+// Any handler can reply with RespondWithReply, but most calls just fetch data, so the Reply
+// adapter turns a function returning a payload into a handler which replies without rerendering.
+
+// ReplyHandler handles a call from gotea.call, returning the payload to resolve the Promise with,
+// or an error to reject it
+type ReplyHandler func(Message, State) (any, error)
+
+// Reply adapts a ReplyHandler for a MessageMap.  The reply is sent without rerendering,
+// and an error rejects the Promise rather than rendering the error view.
+func Reply(handler ReplyHandler) MessageHandler {
+	return func(message Message, state State) Response {
+		payload, err := handler(message, state)
+		if err != nil {
+			return RespondWithError(err)
+		}
+
+		response := RespondWithReply(payload)
+		response.skipRender = true
+		return response
+	}
+}
+
+// RespondWithReply responds to a call from gotea.call, resolving its Promise with the payload.
+// The state is rerendered as usual, and the reply follows the render.  For messages which weren't sent with gotea.call, the reply is ignored.
+func RespondWithReply(payload any) Response {
+	return Response{
+		reply: payload,
+	}
+}
+
+// callReply is a reply to a call, waiting to be sent
+type callReply struct {
+	callID  uint64
+	payload any
+}
+
+// requestReply queues the reply to a call, to be sent after the next render,
+// so that by the time its Promise resolves the page shows the handler's changes.
+// It must be called with the session locked.
+func (sd *sessionData) requestReply(callID uint64, payload any) {
+	sd.pendingReplies = append(sd.pendingReplies, callReply{callID: callID, payload: payload})
+	sd.signalRender()
+}
+
+// replyError rejects the Promise of a call which failed
+func (sd *sessionData) replyError(callID uint64, err error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	writeReply(sd.session, callID, nil, err)
+}
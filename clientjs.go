@@ -0,0 +1,130 @@
+package gotea
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CLIENT JS
+
+// JS is a list of operations which gotea.js carries out in the browser, without a round trip
+// to the server - opening a dropdown, showing a modal, marking a button as busy.
+// Build one by chaining from the zero value, e.g. gt.JS{}.ToggleClass("menu", "open").Focus("menu-search"),
+// then run it from an inline handler with Exec, or from a binding with Run or Binding.WithJS.
+//
+// Operations target the element with the ID, or the element the handler is on if the ID is "".
+// Changes made to classes, attributes and visibility survive renders from the server,
+// unless the server changes the same class or attribute, in which case the server wins.
+type JS struct {
+	ops []jsOp
+}
+
+const (
+	execFuncName = "exec"
+
+	jsOpAddClass    = "addClass"
+	jsOpRemoveClass = "removeClass"
+	jsOpToggleClass = "toggleClass"
+	jsOpShow        = "show"
+	jsOpHide        = "hide"
+	jsOpToggle      = "toggle"
+	jsOpSetAttr     = "setAttr"
+	jsOpRemoveAttr  = "removeAttr"
+	jsOpFocus       = "focus"
+	jsOpSend        = "send"
+)
+
+// jsOp is a named operation, encoded as [name, args] for gotea.js
+type jsOp struct {
+	name string
+	args map[string]any
+}
+
+func (op jsOp) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{op.name, op.args})
+}
+
+func (js JS) MarshalJSON() ([]byte, error) {
+	if js.ops == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(js.ops)
+}
+
+func (js JS) op(name string, args map[string]any) JS {
+	js.ops = appendCopy(js.ops, jsOp{name: name, args: args})
+	return js
+}
+
+// AddClass adds the classes to the element
+func (js JS) AddClass(id string, classes ...string) JS {
+	return js.op(jsOpAddClass, map[string]any{"id": id, "classes": classes})
+}
+
+// RemoveClass removes the classes from the element
+func (js JS) RemoveClass(id string, classes ...string) JS {
+	return js.op(jsOpRemoveClass, map[string]any{"id": id, "classes": classes})
+}
+
+// ToggleClass adds each of the classes the element doesn't have, and removes each that it does
+func (js JS) ToggleClass(id string, classes ...string) JS {
+	return js.op(jsOpToggleClass, map[string]any{"id": id, "classes": classes})
+}
+
+// Show makes the element visible, even if it was rendered hidden by a CSS class
+func (js JS) Show(id string) JS {
+	return js.op(jsOpShow, map[string]any{"id": id})
+}
+
+// Hide hides the element with display: none
+func (js JS) Hide(id string) JS {
+	return js.op(jsOpHide, map[string]any{"id": id})
+}
+
+// Toggle shows the element if it is hidden, and hides it if it is visible
+func (js JS) Toggle(id string) JS {
+	return js.op(jsOpToggle, map[string]any{"id": id})
+}
+
+// SetAttr sets an attribute on the element
+func (js JS) SetAttr(id, name, value string) JS {
+	return js.op(jsOpSetAttr, map[string]any{"id": id, "name": name, "value": value})
+}
+
+// RemoveAttr removes an attribute from the element
+func (js JS) RemoveAttr(id, name string) JS {
+	return js.op(jsOpRemoveAttr, map[string]any{"id": id, "name": name})
+}
+
+// Focus moves the focus to the element
+func (js JS) Focus(id string) JS {
+	return js.op(jsOpFocus, map[string]any{"id": id})
+}
+
+// Send sends the message to the server, after the operations before it have been carried out
+func (js JS) Send(m Message) JS {
+	return js.op(jsOpSend, map[string]any{"message": m})
+}
+
+// String returns the JSON list of operations
+func (js JS) String() string {
+	jsonOps, _ := js.MarshalJSON()
+	return escapeSingleQuotes(jsonOps)
+}
+
+// Exec runs the operations from an inline handler, e.g. a.OnClick(gt.Exec(gt.JS{}.Toggle("menu")))
+func Exec(js JS) string {
+	return fmt.Sprintf(`%s(this, %s)`, constructFuncName(execFuncName), js)
+}
+
+// Run is a binding which runs the operations, without sending a message
+func Run(js JS) Binding {
+	return Binding{}.WithJS(js)
+}
+
+// WithJS runs the operations as soon as the event fires, before the binding's message is sent
+// (which may be later, if it is debounced)
+func (b Binding) WithJS(js JS) Binding {
+	b.spec.Ops = appendCopy(b.spec.Ops, js.ops...)
+	return b
+}
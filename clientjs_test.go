@@ -0,0 +1,52 @@
+package gotea
+
+import (
+	"testing"
+)
+
+func TestClientJS(t *testing.T) {
+	base := JS{}.Show("modal")
+
+	testCases := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			"empty",
+			Exec(JS{}),
+			`gotea.exec(this, [])`,
+		},
+		{
+			"inline",
+			Exec(base.ToggleClass("", "open", "active").Focus("modal-input")),
+			`gotea.exec(this, [["show",{"id":"modal"}],["toggleClass",{"classes":["open","active"],"id":""}],["focus",{"id":"modal-input"}]])`,
+		},
+		{
+			"chains from the same base don't share operations",
+			Exec(base.Hide("menu")),
+			`gotea.exec(this, [["show",{"id":"modal"}],["hide",{"id":"menu"}]])`,
+		},
+		{
+			"send and quotes",
+			Exec(JS{}.SetAttr("title", "title", "it's").Send(Message{Message: "SAVE"})),
+			`gotea.exec(this, [["setAttr",{"id":"title","name":"title","value":"it\u0027s"}],["send",{"message":{"message":"SAVE","args":null,"identifier":"","blockRerender":false}}]])`,
+		},
+		{
+			"binding without a message",
+			BindClick(Run(JS{}.Toggle("menu"))).String(),
+			`data-gotea-click='{"message":"","args":null,"identifier":"","blockRerender":false,"ops":[["toggle",{"id":"menu"}]]}'`,
+		},
+		{
+			"binding with a message",
+			BindClick(SendBasic("SAVE", 1).WithJS(JS{}.AddClass("", "busy"))).String(),
+			`data-gotea-click='{"message":"SAVE","args":1,"identifier":"","blockRerender":false,"ops":[["addClass",{"classes":["busy"],"id":""}]]}'`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if testCase.output != testCase.expected {
+			t.Errorf("Test '%s' failed. Expected %s, got %s", testCase.name, testCase.expected, testCase.output)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package gotea
+
+import (
+	"time"
+)
+
+// CLIENT COMMANDS
+
+// Commands ask the browser to do something imperative, which can't be expressed by rendering.
+// They are sent after the render for the message, and gotea.js carries them out once
+// the render has been applied, so they can refer to elements that have just appeared.
+// Apps can add their own on the JS side with gotea.registerCommand(name, args => {...}),
+// and send them with Response.Command.
+
+const (
+	cmdFocus           = "focus"
+	cmdScrollIntoView  = "scrollIntoView"
+	cmdSetValue        = "setValue"
+	cmdSetTitle        = "setTitle"
+	cmdCopyToClipboard = "copyToClipboard"
+	cmdSetLocalStorage = "setLocalStorage"
+	cmdDownload        = "download"
+	cmdVibrate         = "vibrate"
+	cmdQuery           = "query"
+)
+
+// Built-in client queries, which report state that only the browser knows
+const (
+	// QueryViewport reports {"width": ..., "height": ...} of the browser window in CSS pixels
+	QueryViewport = "viewport"
+	// QueryTimezone reports the IANA timezone name, e.g. "Europe/London"
+	QueryTimezone = "timezone"
+	// QueryLocale reports {"language": "en-GB", "languages": [...]} from the browser's preferences
+	QueryLocale = "locale"
+	// QueryScroll reports {"x": ..., "y": ...}, the scroll position of the page
+	QueryScroll = "scroll"
+)
+
+// clientCommand is a named command, with arguments, for gotea.js to carry out
+type clientCommand struct {
+	name string
+	args map[string]any
+}
+
+// Command adds a named command to the response, to be carried out by the handler
+// registered with gotea.registerCommand.  The arguments are passed to the handler as an object.
+func (r Response) Command(name string, args map[string]any) Response {
+	r.commands = appendCopy(r.commands, clientCommand{name: name, args: args})
+	return r
+}
+
+// Focus moves the focus to the element with the ID
+func (r Response) Focus(id string) Response {
+	return r.Command(cmdFocus, map[string]any{"id": id})
+}
+
+// ScrollIntoView scrolls the page so that the element with the ID is visible
+func (r Response) ScrollIntoView(id string) Response {
+	return r.Command(cmdScrollIntoView, map[string]any{"id": id})
+}
+
+// SetValue sets the value of the field with the ID.  Renders leave the value of the focused field
+// to the user, so use this to change it anyway, e.g. to clear a chat input once its message is sent.
+func (r Response) SetValue(id, value string) Response {
+	return r.Command(cmdSetValue, map[string]any{"id": id, "value": value})
+}
+
+// SetTitle sets the title of the browser tab
+func (r Response) SetTitle(title string) Response {
+	return r.Command(cmdSetTitle, map[string]any{"title": title})
+}
+
+// CopyToClipboard copies the text to the user's clipboard.
+// Browsers only allow this in response to a user action, such as a click.
+func (r Response) CopyToClipboard(text string) Response {
+	return r.Command(cmdCopyToClipboard, map[string]any{"text": text})
+}
+
+// SetLocalStorage stores the value under the key in the browser's localStorage
+func (r Response) SetLocalStorage(key, value string) Response {
+	return r.Command(cmdSetLocalStorage, map[string]any{"key": key, "value": value})
+}
+
+// Download makes the browser download the file at the URL
+func (r Response) Download(url string) Response {
+	return r.Command(cmdDownload, map[string]any{"url": url})
+}
+
+// Vibrate vibrates the device, on devices which support it.
+// The pattern alternates between vibrating and pausing, e.g. Vibrate(200*time.Millisecond, 100*time.Millisecond, 200*time.Millisecond)
+func (r Response) Vibrate(pattern ...time.Duration) Response {
+	ms := make([]int64, len(pattern))
+	for i, d := range pattern {
+		ms[i] = d.Milliseconds()
+	}
+
+	return r.Command(cmdVibrate, map[string]any{"pattern": ms})
+}
+
+// RespondWithClientQuery responds by asking gotea.js to evaluate the named query, without rerendering.
+// The result arrives as the arguments of a follow-up message with the name resultMsg.
+// Apps can add their own queries with gotea.registerQuery(name, () => {...}), which may return a Promise.
+func RespondWithClientQuery(query, resultMsg string) Response {
+	r := Respond().ClientQuery(query, resultMsg)
+	r.skipRender = true
+	return r
+}
+
+// ClientQuery adds a client query to a response, which still rerenders as usual
+func (r Response) ClientQuery(query, resultMsg string) Response {
+	return r.Command(cmdQuery, map[string]any{"query": query, "message": resultMsg})
+}
+
+// requestCommands queues commands to be sent after the next render.
+// It must be called with the session locked.
+func (sd *sessionData) requestCommands(commands []clientCommand) {
+	sd.pendingCommands = append(sd.pendingCommands, commands...)
+	sd.signalRender()
+}
@@ -63,3 +63,35 @@ func (c ComponentID) UpdateForm(msg string, formID string) string {
 		formID,
 	)
 }
+
+// Bindings
+// These are the declarative equivalents of the above, for pages which run under a strict Content-Security-Policy
+
+// Message creates a component message with ComponentID automatically set
+func (c ComponentID) Message(msg string, args any) Message {
+	return Message{
+		Message:     c.UniqueMsg(msg),
+		Arguments:   args,
+		ComponentID: string(c),
+	}
+}
+
+// Send creates a binding for a component message
+func (c ComponentID) Send(msg string, args any) Binding {
+	return Send(c.Message(msg, args))
+}
+
+// SendNoArgs creates a binding for a component message with no arguments
+func (c ComponentID) SendNoArgs(msg string) Binding {
+	return Send(c.Message(msg, nil))
+}
+
+// SendWithValueFromInput creates a binding that reads value from an input
+func (c ComponentID) SendWithValueFromInput(msg string, inputID string) Binding {
+	return SendWithValueFromInput(c.Message(msg, nil), inputID)
+}
+
+// SendForm creates a binding to serialize a form and send as message args
+func (c ComponentID) SendForm(msg string, formID string) Binding {
+	return SendForm(c.Message(msg, nil), formID)
+}
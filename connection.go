@@ -0,0 +1,117 @@
+package gotea
+
+import (
+	"time"
+)
+
+// CONNECTION
+
+// The runtime pings each connection every PingInterval, and gotea.js answers as soon as the ping arrives.
+// Pongs are handled as they come in, rather than waiting their turn in the mailbox,
+// so the round trip measures the connection itself, not how busy the session is.
+
+const (
+	defaultPingInterval = 5 * time.Second
+
+	// pongMessage is the answer gotea.js sends to a ping, with the ping's ID as its arguments
+	pongMessage = "__PONG"
+)
+
+// ConnectionQuality buckets the latency of a connection, for views to show
+type ConnectionQuality int
+
+const (
+	// QualityUnknown is the quality until the first ping has been answered
+	QualityUnknown ConnectionQuality = iota
+	QualityGood
+	QualityFair
+	QualityPoor
+)
+
+// Latencies at or above which a connection is no longer good, or is poor
+const (
+	fairLatency = 150 * time.Millisecond
+	poorLatency = 500 * time.Millisecond
+)
+
+func (q ConnectionQuality) String() string {
+	switch q {
+	case QualityGood:
+		return "good"
+	case QualityFair:
+		return "fair"
+	case QualityPoor:
+		return "poor"
+	default:
+		return "unknown"
+	}
+}
+
+// Connection is embedded by the application model to find out about its connection.
+// The runtime keeps the latency up to date, and rerenders when the quality changes -
+// not on every ping, so views showing the exact latency are only as fresh as the last render.
+type Connection struct {
+	latency time.Duration
+}
+
+// Latency is the round trip time of the last ping, or zero if none has been answered yet
+func (c Connection) Latency() time.Duration {
+	return c.latency
+}
+
+// Quality buckets the latency into good, fair or poor
+func (c Connection) Quality() ConnectionQuality {
+	switch {
+	case c.latency == 0:
+		return QualityUnknown
+	case c.latency < fairLatency:
+		return QualityGood
+	case c.latency < poorLatency:
+		return QualityFair
+	default:
+		return QualityPoor
+	}
+}
+
+// latencyRecorder is fulfilled by embedding Connection
+type latencyRecorder interface {
+	setLatency(latency time.Duration) (qualityChanged bool)
+}
+
+func (c *Connection) setLatency(latency time.Duration) bool {
+	before := c.Quality()
+	c.latency = latency
+	return c.Quality() != before
+}
+
+// ping sends a ping to the attached connection.  Only the latest ping is timed,
+// so an answer to an earlier one, which has taken longer than the ping interval, is ignored.
+func (sd *sessionData) ping() {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if sd.session.IsClosed() {
+		return
+	}
+
+	sd.pingID++
+	sd.pingSentAt = time.Now()
+	writePing(sd.session, sd.pingID, sd.latency)
+}
+
+// pong records the round trip time of the ping with the ID
+func (sd *sessionData) pong(id uint64) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if id != sd.pingID || sd.pingSentAt.IsZero() {
+		return
+	}
+
+	sd.latency = time.Since(sd.pingSentAt)
+	sd.pingSentAt = time.Time{}
+
+	if recorder, ok := sd.state.(latencyRecorder); ok && recorder.setLatency(sd.latency) {
+		sd.requestRender()
+	}
+}
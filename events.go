@@ -0,0 +1,82 @@
+package gotea
+
+import (
+	"github.com/google/uuid"
+)
+
+// EVENTS
+
+// Events carry data, rather than HTML, to JS running in the browser - e.g. a new point for a chart
+// wrapped by a client-side hook.  Like commands, they are sent after the render for the message,
+// and dispatched by gotea.js once the render has been applied.
+// Events without a target go to listeners registered with gotea.on(name, callback).
+
+// clientEvent is a named event with a JSON payload.
+// An event with a target is delivered to the hook mounted on the element with that ID.
+type clientEvent struct {
+	target  string
+	name    string
+	payload any
+}
+
+// RespondWithEvent responds by sending an event to gotea.on(name, ...) listeners, without rerendering.
+// The payload is encoded as JSON.
+func RespondWithEvent(name string, payload any) Response {
+	r := Respond().WithEvent(name, payload)
+	r.skipRender = true
+	return r
+}
+
+// WithEvent adds an event for gotea.on(name, ...) listeners to a response, which still rerenders as usual
+func (r Response) WithEvent(name string, payload any) Response {
+	return r.PushEventTo("", name, payload)
+}
+
+// PushEventTo sends an event to the hook mounted on the element with the ID,
+// which receives the payload in the callback it registered with this.handleEvent(name, callback)
+func (r Response) PushEventTo(id, name string, payload any) Response {
+	r.events = appendCopy(r.events, clientEvent{target: id, name: name, payload: payload})
+	return r
+}
+
+// PushEvent sends an event to gotea.on(name, ...) listeners in every tab of the session, from outside
+// the request cycle - e.g. when a background job finishes.  It returns the number of connections reached.
+func (app *Application) PushEvent(sessionID uuid.UUID, name string, payload any) int {
+	event := clientEvent{name: name, payload: payload}
+	pushed := 0
+
+	sessions, _ := app.Melody.Sessions()
+	for _, s := range sessions {
+		cookie, err := s.Request.Cookie(sessionCookieName)
+		if err != nil || cookie.Value != sessionID.String() {
+			continue
+		}
+
+		if sdRaw, exists := s.Get(melodySessionDataKey); exists {
+			sdRaw.(*sessionData).requestEvents([]clientEvent{event})
+			pushed++
+		}
+	}
+
+	return pushed
+}
+
+// requestEvents queues events to be sent after the next render.  Events have their own lock,
+// so that one session's handlers can push to another without waiting on its state.
+func (sd *sessionData) requestEvents(events []clientEvent) {
+	sd.eventsMu.Lock()
+	sd.pendingEvents = append(sd.pendingEvents, events...)
+	sd.eventsMu.Unlock()
+
+	sd.signalRender()
+}
+
+// takeEvents removes and returns the pending events
+func (sd *sessionData) takeEvents() []clientEvent {
+	sd.eventsMu.Lock()
+	defer sd.eventsMu.Unlock()
+
+	events := sd.pendingEvents
+	sd.pendingEvents = nil
+	return events
+}
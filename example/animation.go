@@ -14,10 +14,10 @@ const (
 	animationBackgroundSize = 500
 	animationBallSize       = 20
 	animationFrameDelay     = 33
+	animationTimer          = "animation"
 )
 
 type Animation struct {
-	Stop                     bool
 	X, Y                     int
 	XDirection, YDirection   bool
 	BackgroundSize, BallSize int
@@ -33,18 +33,13 @@ var animationMessages gt.MessageMap = gt.MessageMap{
 }
 
 func StartAnimation(_ gt.Message, s gt.State) gt.Response {
-	state := model(s)
-	state.Animation.Stop = false
-	return gt.RespondWithDelayedNextMsg(gt.Message{Message: "NEXT_ANIMATION_FRAME"}, animationFrameDelay)
+	// Starting again while running just replaces the pending frame, so there's only ever one loop
+	return gt.RespondWithTimer(animationTimer, animationFrameDelay, gt.Message{Message: "NEXT_ANIMATION_FRAME"})
 }
 
 func NextAnimationFrame(_ gt.Message, s gt.State) gt.Response {
 	state := model(s)
 
-	if state.Animation.Stop {
-		return gt.Respond()
-	}
-
 	if state.Animation.X >= 100 {
 		state.Animation.XDirection = false
 		state.Animation.IncrementX = rand.Intn(5)
@@ -76,25 +71,22 @@ func NextAnimationFrame(_ gt.Message, s gt.State) gt.Response {
 	state.Animation.TranslateX = translate(state.Animation.X, state.Animation.BackgroundSize, state.Animation.BallSize)
 	state.Animation.TranslateY = translate(state.Animation.Y, state.Animation.BackgroundSize, state.Animation.BallSize)
 
-	return gt.RespondWithDelayedNextMsg(gt.Message{Message: "NEXT_ANIMATION_FRAME"}, animationFrameDelay)
+	return gt.RespondWithTimer(animationTimer, animationFrameDelay, gt.Message{Message: "NEXT_ANIMATION_FRAME"})
 }
 
 func StopAnimation(_ gt.Message, s gt.State) gt.Response {
-	state := model(s)
-	state.Animation.Stop = true
-	return gt.Respond()
+	return gt.RespondWithCancelTimer(animationTimer)
 }
 
 func ResetAnimation(_ gt.Message, s gt.State) gt.Response {
 	state := model(s)
-	state.Animation.Stop = true
 	state.Animation.X = 50
 	state.Animation.Y = 50
 	state.Animation.XDirection = true
 	state.Animation.YDirection = true
 	state.Animation.TranslateX = translate(state.Animation.X, state.Animation.BackgroundSize, state.Animation.BallSize)
 	state.Animation.TranslateY = translate(state.Animation.Y, state.Animation.BackgroundSize, state.Animation.BallSize)
-	return gt.Respond()
+	return gt.RespondWithCancelTimer(animationTimer)
 }
 
 func translate(co, backgroundSize, ballSize int) int {
@@ -169,7 +161,7 @@ func (animation Animation) render() h.Element {
 			`
 			<p class="mb-3">This demonstrates a continuous animation loop driven by the server.</p>
 			<ul class="list-disc pl-5 space-y-2">
-				<li><strong class="text-stone-900">Game Loop:</strong> The server sends a <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">NEXT_ANIMATION_FRAME</code> message to itself repeatedly using <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">RespondWithDelayedNextMsg</code>.</li>
+				<li><strong class="text-stone-900">Game Loop:</strong> The server sends a <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">NEXT_ANIMATION_FRAME</code> message to itself repeatedly using a keyed timer, <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">RespondWithTimer</code>. Stopping cancels the pending frame with <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">CancelTimer</code>.</li>
 				<li><strong class="text-stone-900">State Update:</strong> On each tick, the ball's position is updated in the state.</li>
 				<li><strong class="text-stone-900">Rendering:</strong> The new state is rendered and sent to the client. Morphdom ensures only the changed attributes (style) are updated.</li>
 			</ul>
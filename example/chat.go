@@ -57,7 +57,8 @@ func SendMessage(m gt.Message, s gt.State) gt.Response {
 
 	app.Broadcast()
 
-	return gt.Respond()
+	// The input keeps its value through renders, so clear it now the message is sent
+	return gt.Respond().SetValue("messageInput", "")
 }
 
 func (chat Chat) render() h.Element {
@@ -162,10 +163,15 @@ func (chat Chat) render() h.Element {
 				h.Input(a.Attrs(
 					a.Type("text"),
 					a.Id("messageInput"),
+					// Broadcasts from other users mustn't wipe a half-typed message, even after clicking away
+					a.Morph(a.MorphIgnoreValue),
 					a.Placeholder("Type your message.."),
 					a.Class("flex-grow rounded-lg px-4 py-2.5 text-stone-900"))),
 				h.Button(a.Attrs(
 					a.OnClick(gt.SendBasicMessageWithValueFromInput("SEND_MESSAGE", "messageInput")),
+					// Greyed out and disabled until the server has the message, so it can't be sent twice
+					a.LoadingClass("opacity-50 cursor-wait"),
+					a.DisableWhileLoading(true),
 					a.Class("px-5 py-2.5 bg-emerald-500 hover:bg-emerald-600 text-white font-semibold rounded-lg border-2 border-stone-900 shadow-brutal-sm hover:shadow-brutal hover:-translate-x-0.5 hover:-translate-y-0.5 transition-all")),
 					h.Text("Send →")))),
 
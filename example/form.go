@@ -95,6 +95,7 @@ func (f Form) render() h.Element {
 			<ul class="list-disc pl-5 space-y-2">
 				<li><strong class="text-stone-900">Two-Way Binding:</strong> Input values are bound to the state. Events trigger messages that update the state.</li>
 				<li><strong class="text-stone-900">Form Serialization:</strong> The entire form is serialized and sent with each change using <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">BasicUpdateForm</code>.</li>
+				<li><strong class="text-stone-900">Focus Preservation:</strong> Each keystroke rerenders the form, but the field you are typing in keeps its value and caret, so the server's copy never catches you mid-word.</li>
 				<li><strong class="text-stone-900">Validation:</strong> Input validation logic can be implemented in the update function before updating the state.</li>
 			</ul>
 			`),
@@ -18,6 +18,7 @@ import (
 
 type Model struct {
 	gt.Router
+	gt.Connection
 	sessionID uuid.UUID
 
 	TemplateName string
@@ -258,6 +259,9 @@ func (m *Model) Render() []byte {
 					a.Class("absolute top-40 -left-20 w-72 h-72 bg-emerald-200 rounded-full mix-blend-multiply filter blur-3xl opacity-30 animate-blob animation-delay-2000"))),
 				h.Div(a.Attrs(
 					a.Class("absolute -bottom-20 left-1/2 w-80 h-80 bg-rose-200 rounded-full mix-blend-multiply filter blur-3xl opacity-30 animate-blob animation-delay-4000")))),
+			// Shown by gotea.js while the connection is down
+			h.ReconnectBanner(a.Attrs(
+				a.Class("fixed bottom-4 left-1/2 -translate-x-1/2 z-50 px-5 py-3 bg-amber-300 text-stone-900 font-semibold rounded-xl border-2 border-stone-900 shadow-brutal"))),
 			// Header/Nav
 			h.Header(a.Attrs(
 				a.Class("sticky top-0 z-50 backdrop-blur-md bg-stone-100/80 border-b-2 border-stone-900")),
@@ -317,7 +321,13 @@ func (m *Model) Render() []byte {
 								a.Class("text-stone-300")),
 								h.Text("•")),
 							h.Span(a.Attrs(),
-								h.Text(m.Router.Route))),
+								h.Text(m.Router.Route)),
+							h.Span(a.Attrs(
+								a.Class("text-stone-300")),
+								h.Text("•")),
+							h.Span(a.Attrs(
+								a.Title("Connection quality, measured by the server's pings")),
+								h.Text("Connection: "+m.Connection.Quality().String()))),
 						h.Div(a.Attrs(
 							a.Class("text-sm")),
 							h.Text("Built with "),
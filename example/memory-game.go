@@ -21,6 +21,12 @@ var memoryGameMessages gt.MessageMap = gt.MessageMap{
 	"SUBMIT_INITIALS":   SubmitInitials,
 }
 
+// The status panels fade in and out as the game is won, rather than the server sending frames for it
+var (
+	panelEnter = a.Transition{Active: "transition duration-300 ease-out", From: "opacity-0 scale-95", To: "opacity-100 scale-100", Duration: 300 * time.Millisecond}
+	panelLeave = a.Transition{Active: "transition duration-200 ease-in", From: "opacity-100 scale-100", To: "opacity-0 scale-95", Duration: 200 * time.Millisecond}
+)
+
 type Difficulty int
 
 const (
@@ -264,6 +270,7 @@ func (game MemoryGame) render() h.Element {
 			<ul class="list-disc pl-5 space-y-2">
 				<li><strong class="text-stone-900">Component Structure:</strong> The <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">MemoryGame</code> struct encapsulates the game state (Deck, Score, Turns).</li>
 				<li><strong class="text-stone-900">Message Handling:</strong> Game-specific messages (like <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">FLIP_CARD</code>) are handled by the main update function.</li>
+				<li><strong class="text-stone-900">Transitions:</strong> The status panels and new leaderboard rows fade in and out with <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">a.Enter</code> and <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">a.Leave</code>, run by gotea.js as the render adds and removes them.</li>
 				<li><strong class="text-stone-900">Delayed Messages:</strong> When cards don't match, a delayed message flips them back after 1 second using <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">RespondWithDelayedNextMsg</code>.</li>
 			</ul>
 			`),
@@ -317,8 +324,9 @@ func (game MemoryGame) renderLeaderboard() h.Element {
 					h.Text("Turns")),
 				h.Div(a.Attrs(),
 					h.Text("Date"))),
-			// Rows
+			// Rows, keyed so that a new high score slides the others down rather than rebuilding them
 			h.Div(a.Attrs(
+				a.Id("leaderboard-rows"),
 				a.Class("bg-white divide-y-2 divide-stone-200")),
 				func() []h.Element {
 					var rows []h.Element
@@ -332,6 +340,8 @@ func (game MemoryGame) renderLeaderboard() h.Element {
 							medalEmoji = "🥉 "
 						}
 						rows = append(rows, h.Div(a.Attrs(
+							a.Key(fmt.Sprintf("%s-%d", score.Initials, score.Date.UnixNano())),
+							a.Enter(panelEnter),
 							a.Class("grid grid-cols-4 gap-4 px-4 py-3 text-sm")),
 							h.Div(a.Attrs(
 								a.Class("font-mono text-stone-500")),
@@ -373,6 +383,10 @@ func (game MemoryGame) renderStatus() h.Element {
 func (game MemoryGame) renderGameWon() h.Element {
 	if game.AskingForInitials {
 		return h.Div(a.Attrs(
+			// Keyed, so the panel leaves rather than being morphed into the one which replaces it
+			a.Key("initials"),
+			a.Enter(panelEnter),
+			a.Leave(panelLeave),
 			a.Class("text-center space-y-4 bg-gradient-to-br from-amber-100 to-yellow-100 p-8 rounded-2xl border-2 border-stone-900 shadow-brutal")),
 			h.Div(a.Attrs(
 				a.Class("text-5xl mb-2")),
@@ -400,6 +414,9 @@ func (game MemoryGame) renderGameWon() h.Element {
 	}
 
 	return h.Div(a.Attrs(
+		a.Key("won"),
+		a.Enter(panelEnter),
+		a.Leave(panelLeave),
 		a.Class("text-center space-y-4 bg-gradient-to-br from-emerald-100 to-green-100 p-8 rounded-2xl border-2 border-stone-900 shadow-brutal")),
 		h.Div(a.Attrs(
 			a.Class("text-5xl mb-2")),
@@ -39,7 +39,8 @@ func nameSelectorSearchInputUpdate(m gt.Message, s gt.State) gt.Response {
 	state := model(s)
 	input := m.ArgsToString()
 	state.NameSelector.SuggestTags(input)
-	return gt.Respond()
+	// Only the selector has changed, so there's no need to rerender the page
+	return gt.RespondWithPatch(state.NameSelector.RootID(), state.NameSelector.Render())
 }
 
 func renderComponents(nameSelector, tagSelector tagselector.Model) h.Element {
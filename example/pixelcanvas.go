@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strconv"
 	"sync"
 
 	gt "github.com/jpincas/go-tea"
@@ -54,14 +55,17 @@ var pixelCanvasMessages = gt.MessageMap{
 func paintPixel(m gt.Message, s gt.State) gt.Response {
 	state := model(s)
 
-	var args struct {
-		X int `json:"x"`
-		Y int `json:"y"`
+	// The click is handled by the canvas, so the pixel comes from the cell's data attributes
+	dataset := m.EventArgs().Dataset
+	x, errX := strconv.Atoi(dataset["x"])
+	y, errY := strconv.Atoi(dataset["y"])
+	if errX != nil || errY != nil {
+		// Clicked the canvas itself, rather than a pixel
+		return gt.Respond()
 	}
-	m.MustDecodeArgs(&args)
 
 	canvasMutex.Lock()
-	canvasPixels[pixelKey(args.X, args.Y)] = state.PixelCanvas.SelectedColor
+	canvasPixels[pixelKey(x, y)] = state.PixelCanvas.SelectedColor
 	canvasMutex.Unlock()
 
 	app.Broadcast()
@@ -143,18 +147,36 @@ func (pc *PixelCanvas) render() h.Element {
 					css.Display(css.Grid),
 					css.GridTemplateColumns("repeat(32, 1fr)"),
 					css.Gap("0"),
-					css.Background("white"))),
+					css.Background("white")),
+				a.OnClick(gt.SendMessageWithEvent(gt.Message{Message: "PAINT_PIXEL"}, gt.EventDataset))),
 				renderCanvasGrid()...)),
 
-		// Clear button
+		// Clear button, which asks for confirmation in the browser.
+		// The confirmation stays open while other users' paints rerender the page.
 		h.Div(a.Attrs(
 			a.Class("flex justify-center")),
 			h.Button(a.Attrs(
-				a.OnClick(gt.SendBasicMessageNoArgs("CLEAR_CANVAS")),
+				a.Id("clear-button"),
+				a.OnClick(gt.Exec(gt.JS{}.Hide("clear-button").Show("clear-confirm"))),
 				a.Class("inline-flex items-center gap-2 px-5 py-2.5 bg-rose-500 hover:bg-rose-600 text-white font-semibold rounded-xl border-2 border-stone-900 shadow-brutal-sm hover:shadow-brutal hover:-translate-x-0.5 hover:-translate-y-0.5 transition-all")),
 				h.Span(a.Attrs(),
 					h.Text("🗑")),
-				h.Text("Clear Canvas"))),
+				h.Text("Clear Canvas")),
+			h.Div(a.Attrs(
+				a.Id("clear-confirm"),
+				a.Class("flex items-center gap-3"),
+				a.Style(css.Display(css.None))),
+				h.Span(a.Attrs(
+					a.Class("text-sm font-semibold text-stone-700")),
+					h.Text("Clear everyone's canvas?")),
+				h.Button(a.Attrs(
+					a.OnClick(gt.Exec(gt.JS{}.Hide("clear-confirm").Show("clear-button").Send(gt.Message{Message: "CLEAR_CANVAS"}))),
+					a.Class("px-4 py-2 bg-rose-500 hover:bg-rose-600 text-white font-semibold rounded-xl border-2 border-stone-900 shadow-brutal-sm")),
+					h.Text("Clear")),
+				h.Button(a.Attrs(
+					a.OnClick(gt.Exec(gt.JS{}.Hide("clear-confirm").Show("clear-button"))),
+					a.Class("px-4 py-2 bg-white hover:bg-stone-100 text-stone-700 font-semibold rounded-xl border-2 border-stone-900 shadow-brutal-sm")),
+					h.Text("Cancel")))),
 
 		// Instructions
 		renderExplanatoryNote(
@@ -163,6 +185,8 @@ func (pc *PixelCanvas) render() h.Element {
 			<ul class="list-disc pl-5 space-y-2">
 				<li><strong class="text-stone-900">Shared State:</strong> The canvas is stored on the server and shared by all connected users.</li>
 				<li><strong class="text-stone-900">Broadcasting:</strong> When any user paints a pixel, <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">app.Broadcast()</code> re-renders for all clients.</li>
+				<li><strong class="text-stone-900">One handler:</strong> The canvas has a single click handler. <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">gt.SendMessageWithEvent</code> sends the clicked pixel's <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">data-x</code> and <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">data-y</code> with the message.</li>
+				<li><strong class="text-stone-900">Client JS:</strong> The clear confirmation opens with <code class="bg-stone-200 px-1.5 py-0.5 rounded text-xs font-mono">gt.JS</code>, without a round trip, and stays open when the server rerenders.</li>
 				<li><strong class="text-stone-900">Concurrency:</strong> A mutex protects the canvas map from race conditions.</li>
 				<li><strong class="text-stone-900">Per-session:</strong> Each user has their own selected color stored in session state.</li>
 			</ul>
@@ -209,7 +233,8 @@ func renderCanvasGrid() []h.Element {
 					css.Width("12px"),
 					css.Height("12px"),
 					css.BackgroundColor(color)),
-				a.OnClick(gt.SendBasicMessage("PAINT_PIXEL", map[string]int{"x": x, "y": y})))))
+				a.Data("x", strconv.Itoa(x)),
+				a.Data("y", strconv.Itoa(y)))))
 		}
 	}
 	return elements
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/jpincas/go-tea/tester"
+)
+
+func TestLinksResolve(t *testing.T) {
+	session := tester.NewSession(t, &Model{})
+	state := session.GetState().(*Model)
+
+	session.
+		AssertHrefsResolve(renderHome(state.Counter)).
+		AssertHrefsResolve(state.renderRouting())
+}
@@ -2,12 +2,16 @@ package tagselector
 
 import (
 	"strings"
+	"time"
 
 	gt "github.com/jpincas/go-tea"
 	a "github.com/jpincas/go-tea/attributes"
 	h "github.com/jpincas/go-tea/html"
 )
 
+// searchDebounce is how long the search box waits for typing to pause before searching
+const searchDebounce = 200 * time.Millisecond
+
 // Message Constants
 const (
 	MsgSelectTag         = "TAG.SELECT"
@@ -64,14 +68,18 @@ func matchTags(list []string, toMatch string) (matched []string) {
 	return
 }
 
+// RootID is the ID of the component's outermost element,
+// so that a handler can patch just this component rather than rerendering the page
+func (selector Model) RootID() string {
+	return selector.UniqueID("root")
+}
+
 func (selector Model) Render() h.Element {
-	msgSelectTag := selector.UniqueMsg("TAG.SELECT")
-	msgUpdateSearchInput := selector.UniqueMsg("SEARCHINPUT.UPDATE")
-	msgRemoveTag := selector.UniqueMsg("TAG.REMOVE")
+	// The selector uses bindings rather than inline handlers, so it works under a strict Content-Security-Policy
 	searchInputID := selector.UniqueID("search-input")
 
 	return h.Div(
-		a.Attrs(a.Class("bg-white p-5 rounded-xl border-2 border-stone-900 shadow-brutal-sm space-y-4")),
+		a.Attrs(a.Id(selector.RootID()), a.Class("bg-white p-5 rounded-xl border-2 border-stone-900 shadow-brutal-sm space-y-4")),
 		// Search input
 		h.Div(
 			a.Attrs(a.Class("space-y-3")),
@@ -82,7 +90,7 @@ func (selector Model) Render() h.Element {
 					a.Type("text"),
 					a.Placeholder("Start typing to search..."),
 					a.Value(selector.SearchInput),
-					a.OnKeyUp(gt.SendBasicMessageWithValueFromInput(msgUpdateSearchInput, searchInputID)),
+					gt.BindKeyUp(selector.SendWithValueFromInput(MsgSearchInputUpdate, searchInputID).Debounce(searchDebounce)),
 				),
 			),
 			// Suggestions list
@@ -94,7 +102,7 @@ func (selector Model) Render() h.Element {
 						elements = append(elements, h.Li(
 							a.Attrs(
 								a.Class("px-4 py-2 bg-stone-50 hover:bg-emerald-100 rounded-lg cursor-pointer transition-colors font-medium text-stone-700 hover:text-emerald-800 border border-transparent hover:border-emerald-300"),
-								a.OnClick(gt.SendBasicMessage(msgSelectTag, tag)),
+								gt.BindClick(selector.Send(MsgSelectTag, tag)),
 							),
 							h.Text(tag),
 						))
@@ -126,8 +134,10 @@ func (selector Model) Render() h.Element {
 					for _, tag := range selector.SelectedTags {
 						elements = append(elements, h.Li(
 							a.Attrs(
+								// Keyed, so removing a tag doesn't rebuild the ones after it
+								a.Key(tag),
 								a.Class("inline-flex items-center gap-1 px-3 py-1.5 rounded-full text-sm font-semibold bg-emerald-100 text-emerald-800 border-2 border-emerald-300 cursor-pointer hover:bg-rose-100 hover:text-rose-800 hover:border-rose-300 transition-colors"),
-								a.OnClick(gt.SendBasicMessage(msgRemoveTag, tag)),
+								gt.BindClick(selector.Send(MsgRemoveTag, tag)),
 							),
 							h.Text(tag),
 							h.Span(a.Attrs(a.Class("text-xs opacity-60")), h.Text("✕")),
@@ -28,7 +28,8 @@ func teamSelectorSearchInputUpdate(m gt.Message, s gt.State) gt.Response {
 	state := model(s)
 	input := m.ArgsToString()
 	state.TeamSelector.SuggestTags(input)
-	return gt.Respond()
+	// Only the selector has changed, so there's no need to rerender the page
+	return gt.RespondWithPatch(state.TeamSelector.RootID(), state.TeamSelector.Render())
 }
 
 func teamSelectorRemoveTag(m gt.Message, s gt.State) gt.Response {
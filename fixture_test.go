@@ -0,0 +1,280 @@
+package gotea
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	a "github.com/jpincas/go-tea/attributes"
+	h "github.com/jpincas/go-tea/html"
+)
+
+// RUNTIME TEST FIXTURE
+
+// runtimeModel is the application the runtime tests connect to.
+// Each of its messages exercises one kind of response, and its routes render the parts of the state the tests check.
+type runtimeModel struct {
+	Router
+	Connection
+	Counter int
+	Log     []string
+}
+
+func newRuntimeModel() *runtimeModel {
+	m := &runtimeModel{}
+	m.Register("/", func(State) []byte {
+		return []byte("home")
+	})
+	m.Register("/counter", func(s State) []byte {
+		return []byte(strconv.Itoa(s.(*runtimeModel).Counter))
+	})
+	m.Register("/log", func(s State) []byte {
+		return []byte(strings.Join(s.(*runtimeModel).Log, ","))
+	})
+	m.Register("/panic", func(State) []byte {
+		panic("render boom")
+	})
+	return m
+}
+
+// Init copies the template, so each session gets its own state but shares the registered routes
+func (m *runtimeModel) Init(uuid.UUID) State {
+	fresh := *m
+	return &fresh
+}
+
+func (m *runtimeModel) Update() MessageMap {
+	return MessageMap{
+		"INCREMENT": func(_ Message, s State) Response {
+			s.(*runtimeModel).Counter++
+			return Respond()
+		},
+		"APPEND": func(message Message, s State) Response {
+			s.(*runtimeModel).Log = append(s.(*runtimeModel).Log, message.ArgsToString())
+			return Respond()
+		},
+		"PANIC": func(Message, State) Response {
+			panic("boom")
+		},
+		"APPEND_LATER": func(message Message, s State) Response {
+			return RespondWithDelayedNextMsg(Message{Message: "APPEND", Arguments: message.ArgsToString()}, 50*time.Millisecond)
+		},
+		"DEBOUNCE": func(message Message, s State) Response {
+			return RespondWithTimer("debounce", 50*time.Millisecond, Message{Message: "APPEND", Arguments: message.ArgsToString()})
+		},
+		"THROTTLE": func(message Message, s State) Response {
+			return RespondWithThrottle("throttle", 50*time.Millisecond, Message{Message: "APPEND", Arguments: message.ArgsToString()})
+		},
+		"CANCEL": func(message Message, s State) Response {
+			return RespondWithCancelTimer(message.ArgsToString())
+		},
+		"PATCH": func(_ Message, s State) Response {
+			s.(*runtimeModel).Counter++
+			return RespondWithPatch("counter", h.Span(a.Attrs(a.Id("counter")), h.Text(strconv.Itoa(s.(*runtimeModel).Counter))))
+		},
+		"INCREMENT_AND_FOCUS": func(_ Message, s State) Response {
+			s.(*runtimeModel).Counter++
+			return Respond().Focus("counter").SetTitle("Counter")
+		},
+		"PUSH_COUNTER": func(_ Message, s State) Response {
+			return Respond().PushEventTo("chart", "point", s.(*runtimeModel).Counter)
+		},
+		"EVENT": func(_ Message, s State) Response {
+			s.(*runtimeModel).Counter++
+			return RespondWithEvent("counted", s.(*runtimeModel).Counter)
+		},
+		"LOOKUP": Reply(func(message Message, s State) (any, error) {
+			if message.ArgsToString() == "" {
+				return nil, errors.New("nothing to look up")
+			}
+			return []string{message.ArgsToString() + "1", message.ArgsToString() + "2"}, nil
+		}),
+		"ASK_VIEWPORT": func(Message, State) Response {
+			return RespondWithClientQuery(QueryViewport, "VIEWPORT_RESULT")
+		},
+	}
+}
+
+func (m *runtimeModel) Render() []byte               { return m.RenderRoute(m) }
+func (m *runtimeModel) RenderError(err error) []byte { return []byte("error: " + err.Error()) }
+func (m *runtimeModel) OnRouteChange(string)         {}
+
+const testSessionID = "4b2ad0a1-6d0c-4ef3-9fb5-2b7e0a3f5c11"
+
+// testServer serves an app's initial renders and websocket endpoint
+type testServer struct {
+	app *Application
+	url string
+}
+
+// newTestServer serves the app, or the runtime model if app is nil
+func newTestServer(t *testing.T, app *Application) *testServer {
+	t.Helper()
+
+	if app == nil {
+		app = NewApp(newRuntimeModel())
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/server" {
+			app.Melody.HandleRequest(w, r)
+			return
+		}
+		app.handleInitialRender(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return &testServer{app: app, url: server.URL}
+}
+
+// testConnOptions describe the connection made by newTestConn.  The zero value connects
+// a new tab to a new server for the runtime model, on /counter.
+type testConnOptions struct {
+	server *testServer
+	route  string
+	tab    string
+	// query is added to the connection's query string, e.g. "handoff=..."
+	query string
+	// skipHandshake leaves the hello, and anything sent before it, for the test to read
+	skipHandshake bool
+}
+
+// newTestConn connects to the server and, unless told otherwise, reads up to the end of the handshake
+func newTestConn(t *testing.T, opts testConnOptions) (*testServer, *websocket.Conn) {
+	t.Helper()
+
+	if opts.server == nil {
+		opts.server = newTestServer(t, nil)
+	}
+	if opts.route == "" {
+		opts.route = "/counter"
+	}
+
+	query := "whence=" + opts.route + "&v=" + strconv.Itoa(ProtocolVersion)
+	if opts.tab != "" {
+		query += "&tab=" + opts.tab
+	}
+	if opts.query != "" {
+		query += "&" + opts.query
+	}
+
+	conn := dialTestServer(t, opts.server, query)
+	if !opts.skipHandshake {
+		readTestFrameOfType(t, conn, frameHello)
+	}
+
+	return opts.server, conn
+}
+
+// dialTestServer opens a websocket with the query exactly as given, for tests of the handshake itself
+func dialTestServer(t *testing.T, server *testServer, query string) *websocket.Conn {
+	t.Helper()
+
+	header := http.Header{}
+	header.Set("Cookie", "session_id="+testSessionID)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.url, "http")+"/server?"+query, header)
+	if err != nil {
+		t.Fatalf("Could not connect to test server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func sendTestMessage(t *testing.T, conn *websocket.Conn, message Message) {
+	t.Helper()
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message.toJson())); err != nil {
+		t.Fatalf("Could not send message: %v", err)
+	}
+}
+
+// readTestFrame returns the HTML of the next render (or error) sent to the client, skipping other frames
+func readTestFrame(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	for {
+		frame := readTestEnvelope(t, conn)
+		if frame["t"] == frameRender || frame["t"] == frameError {
+			return frame["html"].(string)
+		}
+	}
+}
+
+// readTestFrameUntil reads renders until the expected one arrives, returning how many there were.
+// Renders are coalesced, so a burst of messages may produce fewer renders than messages.
+func readTestFrameUntil(t *testing.T, conn *websocket.Conn, expected string) int {
+	t.Helper()
+
+	for count := 1; ; count++ {
+		if readTestFrame(t, conn) == expected {
+			return count
+		}
+	}
+}
+
+// readTestFrameOfType returns the next frame of the specified type, skipping anything else
+func readTestFrameOfType(t *testing.T, conn *websocket.Conn, frameType string) map[string]any {
+	t.Helper()
+
+	for {
+		if frame := readTestEnvelope(t, conn); frame["t"] == frameType {
+			return frame
+		}
+	}
+}
+
+// readTestEnvelope reads the next frame, which should always be a JSON envelope
+func readTestEnvelope(t *testing.T, conn *websocket.Conn) map[string]any {
+	t.Helper()
+
+	raw := readRawTestFrame(t, conn)
+
+	var frame map[string]any
+	if err := json.Unmarshal([]byte(raw), &frame); err != nil {
+		t.Fatalf("Expected frame to be a JSON envelope, got %s", raw)
+	}
+	if _, hasType := frame["t"]; !hasType {
+		t.Fatalf("Expected frame to have a type, got %s", raw)
+	}
+
+	return frame
+}
+
+func readRawTestFrame(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Could not read frame: %v", err)
+	}
+
+	return string(frame)
+}
+
+// testSessionData returns the session data of the server's only connection.
+// Melody registers a connection after its connect handler has run, so it may not be listed straight away.
+func testSessionData(t *testing.T, server *testServer) *sessionData {
+	t.Helper()
+
+	sessions, _ := server.app.Sessions()
+	for wait := 0; len(sessions) == 0 && wait < 100; wait++ {
+		time.Sleep(10 * time.Millisecond)
+		sessions, _ = server.app.Sessions()
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected 1 connection, got %d", len(sessions))
+	}
+
+	sdRaw, _ := sessions[0].Get(melodySessionDataKey)
+	return sdRaw.(*sessionData)
+}
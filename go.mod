@@ -4,7 +4,6 @@ go 1.23.3
 
 require (
 	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/olahol/melody v1.2.1
 )
-
-require github.com/gorilla/websocket v1.5.0 // indirect
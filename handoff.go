@@ -0,0 +1,131 @@
+package gotea
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// handoffMetaName is the meta tag which carries the handoff token from the initial HTTP render
+	// to gotea.js, which passes it back when opening the websocket.  The token is part of the page,
+	// rather than a cookie, so tabs loading at the same time can't take each other's.
+	handoffMetaName = "gotea-handoff"
+
+	// defaultHandoffTTL is how long a rendered state waits for its websocket before being discarded
+	defaultHandoffTTL = 30 * time.Second
+
+	// defaultHandoffLimit is the most rendered states kept waiting for their websockets at once
+	defaultHandoffLimit = 10000
+)
+
+// handoffStore parks the states rendered by the initial HTTP request, so that the websocket
+// connection that follows can adopt them rather than calling Init and routing all over again.
+// Each state can only be claimed once, and is dropped if the socket never arrives.
+type handoffStore struct {
+	mu     sync.Mutex
+	parked map[string]handoff
+}
+
+type handoff struct {
+	sessionID string
+	state     State
+	expiry    *time.Timer
+}
+
+func newHandoffStore() *handoffStore {
+	return &handoffStore{
+		parked: make(map[string]handoff),
+	}
+}
+
+// park stores the state and returns the one-time token with which it can be claimed.
+// Once limit states are waiting, no more are parked until some are claimed or expire,
+// so requests which never open a websocket (crawlers, curl) can't fill up the memory.
+func (hs *handoffStore) park(sessionID string, state State, ttl time.Duration, limit int) (string, bool) {
+	token := uuid.New().String()
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	if limit > 0 && len(hs.parked) >= limit {
+		return "", false
+	}
+
+	hs.parked[token] = handoff{
+		sessionID: sessionID,
+		state:     state,
+		expiry: time.AfterFunc(ttl, func() {
+			hs.remove(token)
+		}),
+	}
+
+	return token, true
+}
+
+// claim returns the state parked under the token and removes it from the store.
+// The session ID must match, so a leaked token can't be used to take over someone else's state.
+func (hs *handoffStore) claim(token, sessionID string) (State, bool) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	h, ok := hs.parked[token]
+	if !ok {
+		return nil, false
+	}
+
+	delete(hs.parked, token)
+	h.expiry.Stop()
+
+	if h.sessionID != sessionID {
+		return nil, false
+	}
+
+	return h.state, true
+}
+
+func (hs *handoffStore) remove(token string) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	delete(hs.parked, token)
+}
+
+// injectHandoffToken adds the meta tag carrying the token to the rendered page.
+// It goes at the start of the head, so it is there before any script which reads it.
+// Pages without a head get it after the opening html tag (or doctype), or at the very start.
+func injectHandoffToken(page []byte, token string) []byte {
+	meta := []byte(fmt.Sprintf(`<meta name="%s" content="%s">`, handoffMetaName, token))
+
+	position := 0
+	for _, tag := range []string{"<head", "<html", "<!doctype"} {
+		if end := openingTagEnd(page, tag); end != -1 {
+			position = end
+			break
+		}
+	}
+
+	injected := make([]byte, 0, len(page)+len(meta))
+	injected = append(injected, page[:position]...)
+	injected = append(injected, meta...)
+	return append(injected, page[position:]...)
+}
+
+// openingTagEnd returns the index just after the first opening tag with the name, or -1 if there isn't one.
+// The name must be followed by the end of the tag or a space, so <head doesn't match <header.
+func openingTagEnd(page []byte, tag string) int {
+	for start := 0; start+len(tag) < len(page); start++ {
+		if !bytes.EqualFold(page[start:start+len(tag)], []byte(tag)) || strings.IndexByte(">\t\n\r ", page[start+len(tag)]) == -1 {
+			continue
+		}
+		if end := bytes.IndexByte(page[start:], '>'); end != -1 {
+			return start + end + 1
+		}
+		return -1
+	}
+	return -1
+}
@@ -0,0 +1,184 @@
+package gotea
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var handoffMetaPattern = regexp.MustCompile(`<meta name="gotea-handoff" content="([^"]+)">`)
+
+// handoffToken returns the token rendered into the page, or fails the test if there isn't one
+func handoffToken(t *testing.T, page []byte) string {
+	t.Helper()
+
+	match := handoffMetaPattern.FindSubmatch(page)
+	if match == nil {
+		t.Fatalf("Expected page to carry a handoff token, got %s", page)
+	}
+
+	return string(match[1])
+}
+
+func TestHandoff(t *testing.T) {
+	m := newTestRouterModel()
+	app := NewApp(m)
+
+	request := httptest.NewRequest(http.MethodGet, "/login", nil)
+	request.AddCookie(&http.Cookie{Name: "session_id", Value: testSessionID})
+	recorder := httptest.NewRecorder()
+	app.handleInitialRender(recorder, request)
+
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name != sessionCookieName {
+			t.Errorf("Expected the handoff token not to be set as a cookie, got %s", cookie.Name)
+		}
+	}
+
+	token := handoffToken(t, recorder.Body.Bytes())
+
+	if _, ok := app.handoffs.claim(token, "another-session"); ok {
+		t.Errorf("Expected handoff to be refused for a different session")
+	}
+
+	// A refused claim still burns the token, so it can't be retried
+	if _, ok := app.handoffs.claim(token, testSessionID); ok {
+		t.Errorf("Expected handoff token to be single use")
+	}
+
+	token, _ = app.handoffs.park("session", m, time.Minute, 0)
+	state, ok := app.handoffs.claim(token, "session")
+	if !ok || state != State(m) {
+		t.Errorf("Expected parked state to be claimed")
+	}
+
+	if _, ok := app.handoffs.claim(token, "session"); ok {
+		t.Errorf("Expected handoff token to be single use")
+	}
+
+	token, _ = app.handoffs.park("session", m, time.Millisecond, 0)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := app.handoffs.claim(token, "session"); ok {
+		t.Errorf("Expected handoff to expire")
+	}
+}
+
+func TestHandoffLimit(t *testing.T) {
+	app := NewApp(newTestRouterModel())
+	app.HandoffLimit = 2
+
+	render := func() []byte {
+		request := httptest.NewRequest(http.MethodGet, "/login", nil)
+		request.AddCookie(&http.Cookie{Name: "session_id", Value: testSessionID})
+		recorder := httptest.NewRecorder()
+		app.handleInitialRender(recorder, request)
+		return recorder.Body.Bytes()
+	}
+
+	render()
+	token := handoffToken(t, render())
+
+	// With the store full, the page still renders, just without a token to claim
+	if page := render(); handoffMetaPattern.Match(page) || string(page) != "login" {
+		t.Errorf("Expected page to render without a handoff token once the limit is reached, got %s", page)
+	}
+
+	// Claiming a state makes room for another
+	app.handoffs.claim(token, testSessionID)
+	handoffToken(t, render())
+}
+
+func TestInjectHandoffToken(t *testing.T) {
+	meta := `<meta name="gotea-handoff" content="token">`
+
+	testCases := []struct {
+		page     string
+		expected string
+	}{
+		{
+			`<!DOCTYPE html><html><head><title>App</title></head><body></body></html>`,
+			`<!DOCTYPE html><html><head>` + meta + `<title>App</title></head><body></body></html>`,
+		},
+		{
+			`<html lang="en"><HEAD class="x"></HEAD></html>`,
+			`<html lang="en"><HEAD class="x">` + meta + `</HEAD></html>`,
+		},
+		{
+			`<html><body><header>Title</header></body></html>`,
+			`<html>` + meta + `<body><header>Title</header></body></html>`,
+		},
+		{
+			`<!doctype html><body></body>`,
+			`<!doctype html>` + meta + `<body></body>`,
+		},
+		{
+			`<div>fragment</div>`,
+			meta + `<div>fragment</div>`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if injected := string(injectHandoffToken([]byte(testCase.page), "token")); injected != testCase.expected {
+			t.Errorf("Injecting into %s: expected %s, got %s", testCase.page, testCase.expected, injected)
+		}
+	}
+}
+
+// initCountingModel counts the sessions started from Init
+type initCountingModel struct {
+	*runtimeModel
+	inits *int32
+}
+
+func (m initCountingModel) Init(id uuid.UUID) State {
+	atomic.AddInt32(m.inits, 1)
+	return m.runtimeModel.Init(id)
+}
+
+func TestHandoffInitOncePerPageView(t *testing.T) {
+	var inits int32
+	server := newTestServer(t, NewApp(initCountingModel{runtimeModel: newRuntimeModel(), inits: &inits}))
+
+	loadPage := func() string {
+		t.Helper()
+
+		request, _ := http.NewRequest(http.MethodGet, server.url+"/counter", nil)
+		request.AddCookie(&http.Cookie{Name: sessionCookieName, Value: testSessionID})
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatalf("Could not load page: %v", err)
+		}
+		defer response.Body.Close()
+
+		page, _ := io.ReadAll(response.Body)
+		return handoffToken(t, page)
+	}
+
+	// Two tabs of the same session load at the same time, and each gets its own token
+	firstToken, secondToken := loadPage(), loadPage()
+	if firstToken == secondToken {
+		t.Fatalf("Expected each page view to get its own handoff token")
+	}
+	if inits := atomic.LoadInt32(&inits); inits != 2 {
+		t.Fatalf("Expected Init to run once for each page view, ran %d times", inits)
+	}
+
+	// Each socket adopts the state its own page rendered, rather than starting again
+	newTestConn(t, testConnOptions{server: server, tab: "first", query: "handoff=" + firstToken})
+	newTestConn(t, testConnOptions{server: server, tab: "second", query: "handoff=" + secondToken})
+	if inits := atomic.LoadInt32(&inits); inits != 2 {
+		t.Errorf("Expected sockets connecting with a handoff token not to run Init, ran %d times", inits)
+	}
+
+	// A socket without a token starts from Init
+	newTestConn(t, testConnOptions{server: server, tab: "third"})
+	if inits := atomic.LoadInt32(&inits); inits != 3 {
+		t.Errorf("Expected a socket without a handoff token to run Init, ran %d times", inits)
+	}
+}
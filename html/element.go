@@ -238,6 +238,17 @@ func (el Element) RenderIfWithDefault(doRender bool, d Element) Element {
 	return d
 }
 
+// WithKey keys the element, like attributes.Key, so it keeps its identity when its list is reordered
+func (el Element) WithKey(key string) Element {
+	el.Attributes = appendCopy(el.Attributes, attributes.Key(key))
+	return el
+}
+
+// appendCopy appends the items to a copy of the slice, leaving the original alone
+func appendCopy[T any](slice []T, items ...T) []T {
+	return append(append([]T{}, slice...), items...)
+}
+
 func (el *Element) AppendAttrs(attrs ...attributes.Attribute) {
 	el.Attributes = append(el.Attributes, attrs...)
 }
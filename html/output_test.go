@@ -1,7 +1,9 @@
 package html
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jpincas/go-tea/attributes"
 	"github.com/jpincas/go-tea/css"
@@ -84,3 +86,49 @@ func TestOutput(t *testing.T) {
 		t.Errorf("Output was not as expected.  Output: \n%s\n Expected: \n%s\n", output, expected)
 	}
 }
+
+func TestReconnectBanner(t *testing.T) {
+	output := ReconnectBanner(attributes.Attrs(attributes.Class("banner")), Text("Offline")).String()
+	expected := `<div data-gotea-connection-show="reconnecting disconnected" hidden role="status" aria-live="polite" class="banner">`
+
+	if !strings.HasPrefix(output, expected) || !strings.Contains(output, "Offline") {
+		t.Errorf("Expected banner starting %s, got %s", expected, output)
+	}
+}
+
+func TestMorphPolicies(t *testing.T) {
+	output := Input(attributes.Attrs(attributes.Id("search"), attributes.Morph(attributes.MorphIgnoreValue, attributes.MorphIgnoreAttributes))).String()
+	expected := `<input id="search" data-gotea-morph="ignore-value ignore-attributes">`
+
+	if !strings.HasPrefix(output, expected) {
+		t.Errorf("Expected input starting %s, got %s", expected, output)
+	}
+}
+
+func TestWithKey(t *testing.T) {
+	base := Li(attributes.Attrs(attributes.Class("tag")), Text("go"))
+	keyed := base.WithKey("go")
+
+	expected := `<li data-gotea-key="go" class="tag">`
+	if output := keyed.String(); !strings.HasPrefix(output, expected) {
+		t.Errorf("Expected keyed element starting %s, got %s", expected, output)
+	}
+
+	if output := base.String(); strings.Contains(output, "data-gotea-key") {
+		t.Errorf("Expected base element to be left unkeyed, got %s", output)
+	}
+}
+
+func TestTransitions(t *testing.T) {
+	fade := attributes.Transition{Active: "transition", From: "opacity-0", To: "opacity-100", Duration: 300 * time.Millisecond}
+	output := Div(attributes.Attrs(attributes.Enter(fade), attributes.Leave(attributes.Transition{To: "it's-gone"}))).String()
+
+	for _, expected := range []string{
+		`data-gotea-enter='{"active":"transition","duration":300,"from":"opacity-0","to":"opacity-100"}'`,
+		`data-gotea-leave='{"active":"","duration":0,"from":"","to":"it\u0027s-gone"}'`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s in %s", expected, output)
+		}
+	}
+}
@@ -829,6 +829,32 @@ func ItalicText(i interface{}) Element {
 	)
 }
 
+// ReconnectBanner is a status message which gotea.js only shows while the connection to the server is down.
+// Without any elements, it says whether it is reconnecting or offline.
+func ReconnectBanner(attrs attributes.Attributes, elements ...Element) Element {
+	if len(elements) == 0 {
+		elements = Elements{
+			Span(attributes.Attrs(
+				attributes.ShowOnConnection(attributes.ConnectionReconnecting),
+				attributes.Hidden(true)),
+				Text("Connection lost. Reconnecting...")),
+			Span(attributes.Attrs(
+				attributes.ShowOnConnection(attributes.ConnectionDisconnected),
+				attributes.Hidden(true)),
+				Text("You are offline. Changes will be sent when the connection is back.")),
+		}
+	}
+
+	bannerAttrs := attributes.Attrs(
+		attributes.ShowOnConnection(attributes.ConnectionReconnecting, attributes.ConnectionDisconnected),
+		attributes.Hidden(true),
+		attributes.Role("status"),
+		attributes.AriaLive("polite"),
+	)
+
+	return Div(append(bannerAttrs, attrs...), elements...)
+}
+
 // Nothing generates a blank element. The only reason we have the arguments
 // is to make the function type signature the same as the other construction
 // functions
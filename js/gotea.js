@@ -5,6 +5,14 @@ const SOCKET_MESSAGE = "Sent Message:";
 const INITIAL_RECONNECT_DELAY = 1000;  // 1 second
 const MAX_RECONNECT_DELAY = 30000;     // 30 seconds
 const RECONNECT_BACKOFF_MULTIPLIER = 2;
+const MAX_QUEUED_MESSAGES = 100;
+const DEFAULT_CALL_TIMEOUT = 10000;    // 10 seconds
+
+// Must match the pong message in the runtime
+const PONG_MESSAGE = "__PONG";
+
+// Must match gotea.ProtocolVersion
+const PROTOCOL_VERSION = 1;
 
 // Helpers for state persistence
 function getCookie(name) {
@@ -30,6 +38,56 @@ function getStoredState(sessionId) {
   }
 }
 
+// Each tab gets an ID, kept in sessionStorage so it survives reloads.
+// Together with the session cookie it lets the server hold on to this tab's
+// session for a grace period after a disconnect, and resume it when we reconnect.
+//
+// Browsers copy sessionStorage when a tab is duplicated, which would give both tabs
+// the same ID, and let one resume the other's session.  So the ID is only left in
+// sessionStorage while the page is hidden: a duplicate of a live tab finds nothing
+// there and makes its own, while a reload of this tab finds it again.
+const TAB_ID_KEY = 'gotea_tab_id';
+
+function getTabId() {
+  try {
+    let tabId = sessionStorage.getItem(TAB_ID_KEY);
+    sessionStorage.removeItem(TAB_ID_KEY);
+    if (!tabId) {
+      tabId = `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`;
+    }
+    return tabId;
+  } catch (e) {
+    console.warn('Failed to get tab ID:', e);
+    return '';
+  }
+}
+
+const tabId = getTabId();
+
+window.addEventListener('pagehide', () => {
+  try {
+    sessionStorage.setItem(TAB_ID_KEY, tabId);
+  } catch (e) {
+    console.warn('Failed to save tab ID:', e);
+  }
+});
+
+// A page restored from the back/forward cache doesn't rerun this script, so takes its ID back out again
+window.addEventListener('pageshow', (event) => {
+  if (event.persisted) {
+    try {
+      sessionStorage.removeItem(TAB_ID_KEY);
+    } catch (e) {
+      console.warn('Failed to claim tab ID:', e);
+    }
+  }
+});
+
+// The server parks the state it rendered for this page under a one-time token, which it writes
+// into the page.  We pass it back on the first connection so the server doesn't have to Init again.
+const handoffMeta = document.querySelector('meta[name="gotea-handoff"]');
+let handoffToken = handoffMeta ? handoffMeta.content : null;
+
 // WebSocket connection management
 let socket = null;
 let reconnectDelay = INITIAL_RECONNECT_DELAY;
@@ -42,7 +100,155 @@ function buildWebSocketUrl() {
   const restoredStateParam = storedState ?
     `&restored_state=${encodeURIComponent(storedState)}` : '';
 
-  return `${window.location.protocol === "https:" ? "wss://" : "ws://"}${window.location.host}/server?whence=${document.location.pathname}${restoredStateParam}`;
+  // The handoff token is only good for the first connection
+  const handoffParam = handoffToken ? `&handoff=${handoffToken}` : '';
+  handoffToken = null;
+
+  return `${window.location.protocol === "https:" ? "wss://" : "ws://"}${window.location.host}/server?v=${PROTOCOL_VERSION}&whence=${document.location.pathname}${restoredStateParam}${handoffParam}&tab=${tabId}`;
+}
+
+// Every frame from the server is a JSON envelope, tagged with its type in `t`
+const frameHandlers = {
+  // The handshake: check we speak the same protocol, then replay anything the server hasn't seen
+  hello: frame => {
+    if (frame.v !== PROTOCOL_VERSION) {
+      reloadForProtocolMismatch(frame.v);
+      return;
+    }
+    syncOutbox(frame.lastSeq, frame.resumed);
+    setConnectionStatus('connected');
+  },
+  render: frame => {
+    console.log("Received rerender from server");
+    scheduleRender(frame.html);
+  },
+  // Just one element has changed
+  patch: frame => schedulePatch(frame.id, frame.html),
+  snapshot: frame => storeState(getCookie('session_id'), frame.data),
+  // Commands and events are dealt with once the render they follow has been applied
+  cmd: frame => scheduleAfterRender(() => runCommand(frame.cmd, frame.args || {})),
+  error: frame => {
+    console.error("Received error from server");
+    scheduleRender(frame.html);
+  },
+  event: frame => scheduleAfterRender(() => deliverEvent(frame)),
+  // Replies follow the render of the handler that sent them, so the page is up to date when the Promise settles
+  reply: frame => scheduleAfterRender(() => settleCall(frame)),
+  // Every message up to seq has been processed, and its render applied
+  ack: frame => {
+    pruneOutbox(frame.seq);
+    scheduleAfterRender(() => clearLoading(seq => seq <= frame.seq));
+  },
+  // Just that message won't be processed - the ones before it may still be on their way
+  drop: frame => clearLoading(seq => seq === frame.seq),
+  // Answered straight away, rather than through the outbox - a late pong is no use
+  ping: frame => {
+    if (socket && socket.readyState === WebSocket.OPEN) {
+      socket.send(JSON.stringify({ message: PONG_MESSAGE, args: frame.id }));
+    }
+    setLatency(frame.latency);
+  }
+};
+
+// Commands the server can ask us to carry out.
+// Apps can add their own with gotea.registerCommand.
+const commandHandlers = {
+  reload: args => reloadForProtocolMismatch(args.v),
+  // A route guard redirected us - update the URL without firing another route change
+  replaceRoute: args => history.replaceState({}, "", args.route),
+  focus: args => withElement(args.id, el => el.focus()),
+  scrollIntoView: args => withElement(args.id, el => el.scrollIntoView({ behavior: 'smooth' })),
+  // Renders leave a field's value alone while the user is typing in it, so this is how the server overrules them
+  setValue: args => withElement(args.id, el => { el.value = args.value; }),
+  setTitle: args => { document.title = args.title; },
+  copyToClipboard: args => {
+    navigator.clipboard.writeText(args.text)
+      .catch(e => console.warn('Failed to copy to clipboard:', e));
+  },
+  setLocalStorage: args => {
+    try {
+      localStorage.setItem(args.key, args.value);
+    } catch (e) {
+      console.warn('Failed to set localStorage:', e);
+    }
+  },
+  download: args => {
+    const link = document.createElement('a');
+    link.href = args.url;
+    link.download = '';
+    link.className = 'external';
+    document.body.appendChild(link);
+    link.click();
+    link.remove();
+  },
+  vibrate: args => {
+    if (navigator.vibrate) navigator.vibrate(args.pattern);
+  },
+  query: args => runQuery(args.query, args.message)
+};
+
+// Queries report state that only the browser knows, for handlers to ask for with
+// RespondWithClientQuery.  Apps can add their own with gotea.registerQuery.
+// A query may return a Promise, e.g. for a permission check.
+const queryHandlers = {
+  viewport: () => ({ width: window.innerWidth, height: window.innerHeight }),
+  timezone: () => Intl.DateTimeFormat().resolvedOptions().timeZone,
+  locale: () => ({ language: navigator.language, languages: [...(navigator.languages || [])] }),
+  scroll: () => ({ x: window.scrollX, y: window.scrollY })
+};
+
+const registerQuery = (name, fn) => {
+  queryHandlers[name] = fn;
+};
+
+// runQuery evaluates the query and sends the result back as the args of the result message.
+// If the query fails, the result message is still sent, with null args, so the server isn't left waiting.
+async function runQuery(name, resultMessage) {
+  let result = null;
+  try {
+    const query = queryHandlers[name];
+    if (!query) throw new Error('unknown query');
+    result = await query();
+  } catch (e) {
+    console.error(`Query ${name} failed:`, e);
+  }
+  sendMessage({ message: resultMessage, args: result === undefined ? null : result });
+}
+
+function withElement(id, fn) {
+  const el = document.getElementById(id);
+  if (el) {
+    fn(el);
+  } else {
+    console.warn(`Could not find element #${id}`);
+  }
+}
+
+// Register a named command, which handlers can send with Response.Command(name, args)
+const registerCommand = (name, fn) => {
+  commandHandlers[name] = fn;
+};
+
+function runCommand(name, args) {
+  const command = commandHandlers[name];
+  if (!command) {
+    console.warn(`Ignoring unknown command: ${name}`);
+    return;
+  }
+  try {
+    command(args);
+  } catch (e) {
+    console.error(`Command ${name} failed:`, e);
+  }
+}
+
+// The server and this script are out of step - typically because the tab loaded
+// before a deploy - so reload to pick up the matching version of the script
+function reloadForProtocolMismatch(serverVersion) {
+  console.warn(`Protocol version mismatch (client ${PROTOCOL_VERSION}, server ${serverVersion}), reloading`);
+  intentionalClose = true;
+  if (socket) socket.close();
+  window.location.reload();
 }
 
 function connect() {
@@ -51,29 +257,21 @@ function connect() {
   socket = new WebSocket(buildWebSocketUrl());
 
   socket.onmessage = event => {
-    const data = event.data;
-
-    // Try to parse as JSON to check for system messages
+    let frame;
     try {
-      const msg = JSON.parse(data);
-      if (msg.type === 'STATE_SNAPSHOT') {
-        const sessionId = getCookie('session_id');
-        storeState(sessionId, msg.data);
-        return; // Don't render system messages
-      }
+      frame = JSON.parse(event.data);
     } catch (e) {
-      // Not JSON, treat as HTML
+      console.error("Received malformed frame from server:", e);
+      return;
     }
 
-    console.log("Received rerender from server");
-    morphdom(document.documentElement, event.data, {
-      childrenOnly: true,
-      onBeforeElUpdated: function(fromEl, toEl) {
-        if (fromEl.hasAttribute('data-morph-skip')) return false;
-        return true;
-      }
-    });
-    if (window.gotea && window.gotea._afterRender) window.gotea._afterRender();
+    const handler = frameHandlers[frame.t];
+    if (handler) {
+      handler(frame);
+    } else {
+      // Frames from a newer server that we don't understand are ignored
+      console.warn(`Ignoring unknown frame type: ${frame.t}`);
+    }
   };
 
   socket.onopen = () => {
@@ -87,6 +285,9 @@ function connect() {
   };
 
   socket.onclose = event => {
+    // Hold outgoing messages until the next connection has synced
+    synced = false;
+
     if (event.wasClean) {
       console.log(`WebSocket connection closed cleanly, code=${event.code}, reason=${event.reason}`);
     } else {
@@ -94,10 +295,481 @@ function connect() {
     }
 
     // Attempt reconnection unless intentionally closed
-    if (!intentionalClose) {
-      scheduleReconnect();
+    if (intentionalClose) {
+      setConnectionStatus('disconnected');
+      return;
+    }
+    setConnectionStatus(navigator.onLine === false ? 'disconnected' : 'reconnecting', { delay: reconnectDelay });
+    scheduleReconnect();
+  };
+}
+
+// Connection status.
+// The status is shown on <html> as a class (gotea-connecting, gotea-connected, gotea-reconnecting
+// or gotea-disconnected) and as data-gotea-connection, and announced with a CustomEvent on the
+// document (gotea:connected etc).  Elements rendered with h.ReconnectBanner, or any element with
+// data-gotea-connection-show="<statuses>", are only shown while the status is one of those listed.
+// The latency measured by the server's pings is kept in data-gotea-latency, in milliseconds,
+// and announced with gotea:latency.
+const CONNECTION_STATUSES = ['connecting', 'connected', 'reconnecting', 'disconnected'];
+const CONNECTION_SHOW_ATTRIBUTE = 'data-gotea-connection-show';
+let connectionStatus = null;
+
+function setConnectionStatus(status, detail = {}) {
+  if (status === connectionStatus) return;
+  connectionStatus = status;
+
+  const root = document.documentElement;
+  CONNECTION_STATUSES.forEach(s => root.classList.toggle(`gotea-${s}`, s === status));
+  root.setAttribute('data-gotea-connection', status);
+  updateConnectionElements();
+
+  document.dispatchEvent(new CustomEvent(`gotea:${status}`, { detail }));
+}
+
+function updateConnectionElements() {
+  document.querySelectorAll(`[${CONNECTION_SHOW_ATTRIBUTE}]`).forEach(el => {
+    const statuses = el.getAttribute(CONNECTION_SHOW_ATTRIBUTE).split(/\s+/);
+    el.hidden = !statuses.includes(connectionStatus);
+  });
+}
+
+function setLatency(latency) {
+  if (!latency) return;
+  document.documentElement.setAttribute('data-gotea-latency', Math.round(latency));
+  document.dispatchEvent(new CustomEvent('gotea:latency', { detail: { latency } }));
+}
+
+// The browser knows when the network has gone, and when it's back there's no point waiting out the backoff
+window.addEventListener('offline', () => setConnectionStatus('disconnected'));
+window.addEventListener('online', () => {
+  if (socket && socket.readyState !== WebSocket.CLOSED) return;
+  clearTimeout(reconnectTimeout);
+  reconnectDelay = INITIAL_RECONNECT_DELAY;
+  setConnectionStatus('reconnecting', { delay: 0 });
+  connect();
+});
+
+// Renders are applied once per animation frame.  If several arrive before the
+// next frame, only the latest is applied, since each one is the whole page.
+// Patches to single elements are applied after it, in the order they arrived,
+// and then any commands and events are dealt with.
+let pendingRender = null;
+let pendingPatches = [];
+let pendingAfterRender = [];
+let frameScheduled = false;
+
+function scheduleRender(html) {
+  pendingRender = html;
+  // The whole page supersedes any patches that came before it
+  pendingPatches = [];
+  scheduleFrame();
+}
+
+function schedulePatch(id, html) {
+  pendingPatches.push({ id, html });
+  scheduleFrame();
+}
+
+function scheduleAfterRender(fn) {
+  pendingAfterRender.push(fn);
+  scheduleFrame();
+}
+
+function scheduleFrame() {
+  if (!frameScheduled) {
+    frameScheduled = true;
+    requestAnimationFrame(applyRender);
+  }
+}
+
+// Morph policies let an element opt out of parts of each render, with a.Morph(...).
+// Whatever the policy, the value of the focused field belongs to the user while they are typing in it,
+// unless the element is rendered with the force policy.
+const MORPH_ATTRIBUTE = 'data-gotea-morph';
+const MORPH_IGNORE_VALUE = 'ignore-value';
+const MORPH_IGNORE_CHILDREN = 'ignore-children';
+const MORPH_IGNORE_ATTRIBUTES = 'ignore-attributes';
+const MORPH_FORCE = 'force';
+
+function morphPolicies(el) {
+  return (el.getAttribute(MORPH_ATTRIBUTE) || '').split(/\s+/).filter(Boolean);
+}
+
+function isValueField(el) {
+  return el.tagName === 'INPUT' || el.tagName === 'TEXTAREA' || el.tagName === 'SELECT';
+}
+
+// keepValue copies what the user has entered in fromEl onto toEl, so morphdom has nothing to change
+function keepValue(fromEl, toEl) {
+  if (fromEl.tagName === 'SELECT') {
+    // morphdom selects the options which the server rendered as selected
+    const selected = new Set([...fromEl.selectedOptions].map(option => option.value));
+    [...toEl.options].forEach(option => {
+      if (selected.has(option.value)) option.setAttribute('selected', '');
+      else option.removeAttribute('selected');
+    });
+    return;
+  }
+
+  if (fromEl.type === 'checkbox' || fromEl.type === 'radio') {
+    toEl.checked = fromEl.checked;
+    return;
+  }
+
+  toEl.value = fromEl.value;
+}
+
+// keepAttributes replaces toEl's attributes with fromEl's, apart from the policy itself,
+// so the server can still lift it
+function keepAttributes(fromEl, toEl) {
+  const policy = toEl.getAttribute(MORPH_ATTRIBUTE);
+  [...toEl.attributes].forEach(attr => toEl.removeAttribute(attr.name));
+  [...fromEl.attributes].forEach(attr => toEl.setAttribute(attr.name, attr.value));
+  if (policy === null) toEl.removeAttribute(MORPH_ATTRIBUTE);
+  else toEl.setAttribute(MORPH_ATTRIBUTE, policy);
+}
+
+// captureFocus records the focused element and its selection before a render
+function captureFocus() {
+  const el = document.activeElement;
+  if (!el || el === document.body) return null;
+  return { el, id: el.id, selection: readSelection(el) };
+}
+
+function readSelection(el) {
+  try {
+    if (typeof el.selectionStart === 'number') {
+      return { start: el.selectionStart, end: el.selectionEnd, direction: el.selectionDirection, value: el.value };
+    }
+  } catch (e) {
+    // Some inputs, such as email, have no selection
+  }
+  return null;
+}
+
+// restoreFocus puts the focus and caret back where they were, if the render replaced the focused element,
+// moved it (which blurs it), or forced a new value into it.  Focus the app moved on purpose is left alone.
+function restoreFocus(focus) {
+  if (!focus) return;
+
+  let el = focus.el;
+  if (!el.isConnected) {
+    el = focus.id ? document.getElementById(focus.id) : null;
+    if (!el) return;
+  }
+
+  const active = document.activeElement;
+  const refocused = active !== el;
+  if (refocused) {
+    if (active && active !== document.body) return;
+    el.focus({ preventScroll: true });
+  }
+
+  const selection = focus.selection;
+  if (!selection || !(refocused || el !== focus.el || el.value !== selection.value)) return;
+  try {
+    const length = el.value.length;
+    el.setSelectionRange(Math.min(selection.start, length), Math.min(selection.end, length), selection.direction);
+  } catch (e) {
+    // The replacement may be a different kind of element
+  }
+}
+
+// Elements rendered with a.Key are matched by their key, as well as by their ID, so reordering a list moves
+// its elements rather than rebuilding them.  morphdom looks keys up across the whole render, so they are
+// scoped by the nearest ancestor with an ID, and need only be unique within it.
+const KEY_ATTRIBUTE = 'data-gotea-key';
+
+function nodeKey(node) {
+  if (node.nodeType !== Node.ELEMENT_NODE) return undefined;
+  // No new element can match one which is on its way out
+  if (leavingEls.has(node)) return leavingEls.get(node);
+
+  const key = node.getAttribute(KEY_ATTRIBUTE);
+  if (key === null) return node.id || undefined;
+
+  const scope = node.parentElement && node.parentElement.closest('[id]');
+  // IDs can't contain spaces, so a scoped key can't be mistaken for an ID
+  return `${scope ? scope.id : ''} ${key}`;
+}
+
+// checkKeys warns about keys used more than once in the same scope, which morphdom can't tell apart.
+// It only runs in dev mode.
+function checkKeys() {
+  if (!window.gotea.devMode) return;
+
+  const seen = new Set();
+  document.querySelectorAll(`[${KEY_ATTRIBUTE}]`).forEach(el => {
+    if (leavingEls.has(el)) return;
+    const key = nodeKey(el);
+    if (seen.has(key)) {
+      console.warn(`Duplicate key "${el.getAttribute(KEY_ATTRIBUTE)}" - keys must be unique within the nearest ancestor with an ID`, el);
+    }
+    seen.add(key);
+  });
+}
+
+// Transitions run when a render adds an element with a.Enter, or removes one with a.Leave.
+// For the whole of the transition, the element has the active classes; it starts with the from classes,
+// which are swapped for the to classes on the next frame.  The classes are client changes,
+// so renders during the transition don't cut it short.  A leaving element stays on the page,
+// untouched by renders, until its transition has finished.
+const ENTER_ATTRIBUTE = 'data-gotea-enter';
+const LEAVE_ATTRIBUTE = 'data-gotea-leave';
+const leavingEls = new Map();
+let leavingCount = 0;
+
+function readTransition(el, attribute) {
+  const json = el.getAttribute(attribute);
+  if (!json) return null;
+  try {
+    return JSON.parse(json);
+  } catch (e) {
+    console.warn(`Invalid transition in ${attribute}:`, json);
+    return null;
+  }
+}
+
+function transitionClasses(classes) {
+  return (classes || '').split(/\s+/).filter(Boolean).map(name => `class:${name}`);
+}
+
+function runTransition(el, transition, done) {
+  const active = transitionClasses(transition.active);
+  const from = transitionClasses(transition.from);
+  const to = transitionClasses(transition.to);
+
+  active.concat(from).forEach(key => setClientChange(el, key, true));
+  // Wait for the from classes to be painted, or there is nothing to transition from
+  requestAnimationFrame(() => requestAnimationFrame(() => {
+    from.forEach(key => revertClientChange(el, key));
+    to.forEach(key => setClientChange(el, key, true));
+  }));
+
+  setTimeout(() => {
+    active.concat(to).forEach(key => revertClientChange(el, key));
+    if (done) done();
+  }, transition.duration);
+}
+
+function enterElement(node) {
+  if (node.nodeType !== Node.ELEMENT_NODE) return;
+  const transition = readTransition(node, ENTER_ATTRIBUTE);
+  if (transition) runTransition(node, transition);
+}
+
+// leaveElement starts the element's leave transition, and reports whether it will remove the element itself
+function leaveElement(node) {
+  if (node.nodeType !== Node.ELEMENT_NODE) return false;
+  if (leavingEls.has(node)) return true;
+
+  const transition = readTransition(node, LEAVE_ATTRIBUTE);
+  if (!transition) return false;
+
+  leavingEls.set(node, `leaving ${++leavingCount}`);
+  runTransition(node, transition, () => {
+    leavingEls.delete(node);
+    node.remove();
+    // Hooks inside are destroyed now, rather than at the next render
+    mountHooks();
+  });
+  return true;
+}
+
+function morphOptions(options) {
+  return Object.assign({
+    getNodeKey: nodeKey,
+    onNodeAdded: function(node) {
+      enterElement(node);
+      return node;
+    },
+    onBeforeNodeDiscarded: function(node) {
+      return !leaveElement(node);
+    },
+    onBeforeElUpdated: function(fromEl, toEl) {
+      if (fromEl.hasAttribute('data-morph-skip')) return false;
+      if (leavingEls.has(fromEl)) return false;
+
+      preserveClientChanges(fromEl, toEl);
+
+      // The policies are read from the new render, so the server can change them
+      const policies = morphPolicies(toEl);
+      if (policies.includes(MORPH_IGNORE_ATTRIBUTES)) keepAttributes(fromEl, toEl);
+      if (isValueField(fromEl) && !policies.includes(MORPH_FORCE) &&
+          (policies.includes(MORPH_IGNORE_VALUE) || fromEl === document.activeElement)) {
+        keepValue(fromEl, toEl);
+      }
+
+      // A hooked element's children belong to the hook, but its attributes follow the server
+      const hookName = fromEl.getAttribute(HOOK_ATTRIBUTE);
+      if (hookName && hookName === toEl.getAttribute(HOOK_ATTRIBUTE) && mountedHooks.has(fromEl)) {
+        if (syncAttributes(fromEl, toEl)) updatedHookEls.add(fromEl);
+        return false;
+      }
+
+      return true;
+    },
+    onBeforeElChildrenUpdated: function(fromEl, toEl) {
+      return !morphPolicies(toEl).includes(MORPH_IGNORE_CHILDREN);
+    }
+  }, options);
+}
+
+function applyRender() {
+  const html = pendingRender;
+  const patches = pendingPatches;
+  const afterRender = pendingAfterRender;
+  pendingRender = null;
+  pendingPatches = [];
+  pendingAfterRender = [];
+  frameScheduled = false;
+
+  const focus = html !== null || patches.length > 0 ? captureFocus() : null;
+
+  if (html !== null) {
+    morphdom(document.documentElement, html, morphOptions({ childrenOnly: true }));
+  }
+
+  patches.forEach(patch => {
+    const el = document.getElementById(patch.id);
+    if (!el) {
+      console.warn(`Could not patch element #${patch.id}: not found`);
+      return;
+    }
+    morphdom(el, patch.html, morphOptions());
+  });
+
+  if (html !== null || patches.length > 0) {
+    restoreFocus(focus);
+    checkKeys();
+    mountHooks();
+    updateConnectionElements();
+    if (window.gotea && window.gotea._afterRender) window.gotea._afterRender();
+  }
+
+  afterRender.forEach(fn => fn());
+}
+
+// Hooks wrap third-party JS widgets (charts, maps, editors) in elements rendered with a.Hook(name).
+// Each hooked element gets its own instance of the hook, with these lifecycle callbacks:
+//   mounted()   - the element has been added to the page
+//   updated()   - the server has changed the element's attributes
+//   destroyed() - the element has been removed
+// Inside them, this.el is the element, this.pushMessage(message, args) sends a message to the server,
+// and this.handleEvent(name, callback) receives events sent with Response.PushEventTo(id, name, payload).
+const HOOK_ATTRIBUTE = 'data-gotea-hook';
+const hooks = {};
+const mountedHooks = new Map();
+let updatedHookEls = new Set();
+
+const registerHook = (name, hook) => {
+  hooks[name] = hook;
+  // Elements may already be on the page
+  mountHooks();
+};
+
+function mountHooks() {
+  const updated = updatedHookEls;
+  updatedHookEls = new Set();
+
+  mountedHooks.forEach((instance, el) => {
+    if (!el.isConnected || el.getAttribute(HOOK_ATTRIBUTE) !== instance.hookName) {
+      mountedHooks.delete(el);
+      callHook(instance, 'destroyed');
+    } else if (updated.has(el)) {
+      callHook(instance, 'updated');
     }
+  });
+
+  document.querySelectorAll(`[${HOOK_ATTRIBUTE}]`).forEach(el => {
+    if (mountedHooks.has(el)) return;
+
+    const hookName = el.getAttribute(HOOK_ATTRIBUTE);
+    const hook = hooks[hookName];
+    if (!hook) return; // Not registered yet
+
+    const instance = Object.create(hook);
+    instance.el = el;
+    instance.hookName = hookName;
+    instance.eventHandlers = {};
+    // Hooks manage their own elements, so their messages don't mark anything as loading
+    instance.pushMessage = (message, args) => withOrigin(null, () => sendMessage({ message, args }));
+    instance.handleEvent = (name, callback) => { instance.eventHandlers[name] = callback; };
+
+    mountedHooks.set(el, instance);
+    callHook(instance, 'mounted');
+  });
+}
+
+function callHook(instance, callback) {
+  if (typeof instance[callback] !== 'function') return;
+  try {
+    instance[callback]();
+  } catch (e) {
+    console.error(`Hook ${instance.hookName} failed in ${callback}:`, e);
+  }
+}
+
+// syncAttributes copies toEl's attributes onto fromEl, and reports whether any changed
+function syncAttributes(fromEl, toEl) {
+  let changed = false;
+  [...fromEl.attributes].forEach(attr => {
+    if (toEl.hasAttribute(attr.name)) return;
+    fromEl.removeAttribute(attr.name);
+    changed = true;
+  });
+  [...toEl.attributes].forEach(attr => {
+    if (fromEl.getAttribute(attr.name) === attr.value) return;
+    fromEl.setAttribute(attr.name, attr.value);
+    changed = true;
+  });
+  return changed;
+}
+
+// Listeners for events sent with RespondWithEvent and app.PushEvent
+const eventListeners = {};
+
+// Listen for an event from the server.  Returns a function which stops listening.
+const on = (name, callback) => {
+  (eventListeners[name] = eventListeners[name] || []).push(callback);
+  return () => {
+    eventListeners[name] = eventListeners[name].filter(cb => cb !== callback);
   };
+};
+
+// deliverEvent delivers an event from the server.
+// An event with a target goes to the hook mounted on the element with that ID,
+// otherwise it goes to listeners registered with gotea.on.
+function deliverEvent(frame) {
+  if (!frame.target) {
+    const callbacks = eventListeners[frame.name] || [];
+    if (callbacks.length === 0) {
+      console.warn(`No listeners for event ${frame.name}`);
+    }
+    callbacks.forEach(callback => {
+      try {
+        callback(frame.payload);
+      } catch (e) {
+        console.error(`Listener for event ${frame.name} failed:`, e);
+      }
+    });
+    return;
+  }
+
+  const el = document.getElementById(frame.target);
+  const instance = el && mountedHooks.get(el);
+  const handler = instance && instance.eventHandlers[frame.name];
+  if (!handler) {
+    console.warn(`No hook on #${frame.target} is handling event ${frame.name}`);
+    return;
+  }
+
+  try {
+    handler(frame.payload);
+  } catch (e) {
+    console.error(`Handler for event ${frame.name} failed:`, e);
+  }
 }
 
 function scheduleReconnect() {
@@ -117,53 +789,302 @@ function scheduleReconnect() {
 }
 
 // Initial connection
+setConnectionStatus('connecting');
 connect();
 
+// Outgoing message queue.
+// Every message is numbered and kept in the outbox, so that anything sent
+// while the socket is down (or lost as it went down) can be replayed on reconnect.
+// The server ignores any sequence number it has already processed, so replays are safe.
+let nextSeq = 1;
+let outbox = [];
+let synced = false;
+
 // Helper to safely send through websocket
-function safeSend(data) {
-  if (socket && socket.readyState === WebSocket.OPEN) {
-    socket.send(data);
+function safeSend(msg) {
+  msg.seq = nextSeq++;
+  const entry = { seq: msg.seq, data: JSON.stringify(msg), sent: false };
+  markLoading(messageOrigin(), msg.seq);
+
+  outbox.push(entry);
+  if (outbox.length > MAX_QUEUED_MESSAGES) {
+    // The oldest message will never be sent, so its element mustn't wait for it
+    const dropped = outbox.shift();
+    console.warn(`Outbox full, dropping queued message ${dropped.seq}`);
+    clearLoading(seq => seq === dropped.seq);
+  }
+
+  if (socket && socket.readyState === WebSocket.OPEN && synced) {
+    socket.send(entry.data);
+    entry.sent = true;
     return true;
   } else {
     console.warn("WebSocket not connected. Message queued for reconnection.");
-    // Could implement message queuing here if needed
     return false;
   }
 }
 
+// syncOutbox replays queued messages once the server has told us the last one it processed.
+// A resumed session knows exactly where it got to.  A fresh session can't make use of
+// messages that were sent to the old one, so only those that never went out are replayed.
+function syncOutbox(lastSeq, resumed) {
+  // A fresh page resuming a held session numbers its messages from 1, but the server has
+  // already processed up to lastSeq and would take them for replays.  Carry on from there,
+  // renumbering anything queued before the handshake.
+  if (resumed) {
+    nextSeq = Math.max(nextSeq, lastSeq + 1);
+    outbox.filter(entry => !entry.sent && entry.seq <= lastSeq).forEach(renumber);
+  }
+
+  outbox = outbox.filter(entry => resumed ? entry.seq > lastSeq : !entry.sent);
+
+  // Messages which won't be replayed are done with, one way or another
+  const replaying = new Set(outbox.map(entry => entry.seq));
+  clearLoading(seq => !replaying.has(seq));
+
+  if (outbox.length > 0) {
+    console.log(`Replaying ${outbox.length} queued message(s)`);
+  }
+
+  outbox.forEach(entry => {
+    socket.send(entry.data);
+    entry.sent = true;
+  });
+
+  synced = true;
+}
+
+// pruneOutbox removes the messages the server has processed, up to and including seq,
+// so they don't take up room needed by messages queued while the socket is down
+function pruneOutbox(seq) {
+  outbox = outbox.filter(entry => entry.seq > seq);
+}
+
+// renumber gives a queued message the next sequence number, along with its loading state
+function renumber(entry) {
+  const seq = nextSeq++;
+  const msg = JSON.parse(entry.data);
+  msg.seq = seq;
+  entry.data = JSON.stringify(msg);
+
+  if (loadingEls.has(entry.seq)) {
+    loadingEls.set(seq, loadingEls.get(entry.seq));
+    loadingEls.delete(entry.seq);
+  }
+  entry.seq = seq;
+}
+
+// Loading states.
+// The element a message was sent from is marked as loading until the server acknowledges the message,
+// after its render.  It gets a class (gotea-loading, or those in a.LoadingClass) and aria-busy,
+// and is disabled if it has a.DisableWhileLoading.  These are client changes, so renders in the
+// meantime don't remove them.
+const DEFAULT_LOADING_CLASS = 'gotea-loading';
+const LOADING_CLASS_ATTRIBUTE = 'data-gotea-loading-class';
+const LOADING_DISABLE_ATTRIBUTE = 'data-gotea-loading-disable';
+const loadingEls = new Map(); // seq -> element
+
+// The origin of a message is the element whose handler sent it.  Inline handlers are found from
+// the event being dispatched; bindings, and handlers run later by a rate limiter, say explicitly.
+let currentOrigin;
+
+function withOrigin(el, fn) {
+  const previous = currentOrigin;
+  currentOrigin = el;
+  try {
+    return fn();
+  } finally {
+    currentOrigin = previous;
+  }
+}
+
+function messageOrigin() {
+  if (currentOrigin !== undefined) return currentOrigin;
+  const event = window.event;
+  return event && event.currentTarget instanceof Element ? event.currentTarget : null;
+}
+
+function loadingChanges(el) {
+  const classes = (el.getAttribute(LOADING_CLASS_ATTRIBUTE) || DEFAULT_LOADING_CLASS).split(/\s+/).filter(Boolean);
+  const changes = classes.map(name => [`class:${name}`, true]);
+  changes.push(['attr:aria-busy', 'true']);
+  if (el.hasAttribute(LOADING_DISABLE_ATTRIBUTE)) {
+    changes.push(['attr:disabled', '']);
+  }
+  return changes;
+}
+
+function markLoading(el, seq) {
+  if (!el || !el.isConnected) return;
+
+  if (![...loadingEls.values()].includes(el)) {
+    loadingChanges(el).forEach(([key, value]) => setClientChange(el, key, value));
+  }
+  loadingEls.set(seq, el);
+}
+
+function clearLoading(isDone) {
+  const done = new Set();
+  loadingEls.forEach((el, seq) => {
+    if (isDone(seq)) {
+      loadingEls.delete(seq);
+      done.add(el);
+    }
+  });
+
+  // An element with another message in flight stays loading
+  const stillLoading = new Set(loadingEls.values());
+  done.forEach(el => {
+    if (!stillLoading.has(el)) {
+      loadingChanges(el).forEach(([key]) => revertClientChange(el, key));
+    }
+  });
+}
+
 // Send a message through the websocket
 const sendMessage = (msg) => {
-  const msgJsonString = JSON.stringify(msg);
-  console.log(`${SOCKET_MESSAGE}`, msgJsonString);
-  safeSend(msgJsonString);
+  console.log(`${SOCKET_MESSAGE}`, JSON.stringify(msg));
+  safeSend(msg);
 };
 
 // Send a message with a value from an input field
 const sendMessageWithValueFromInput = (msg, inputID) => {
   msg.args = document.getElementById(inputID).value;
 
-  const msgJsonString = JSON.stringify(msg);
-  console.log(`${SOCKET_MESSAGE}`, msgJsonString);
-  safeSend(msgJsonString);
+  console.log(`${SOCKET_MESSAGE}`, JSON.stringify(msg));
+  safeSend(msg);
 };
 
+// Send a message with the value of the input whose handler sent it.  A debounced or throttled
+// handler runs after focus may have moved on, so the input is taken from its origin if it has one.
 const sendMessageWithValueFromThisInput = (msg) => {
-  msg.args = document.activeElement.value;
+  msg.args = (currentOrigin || document.activeElement).value;
+
+  console.log(`${SOCKET_MESSAGE}`, JSON.stringify(msg));
+  safeSend(msg);
+};
+
+// Send a message with properties of the event that triggered it.
+// The message's own args go under "args", alongside the requested fields.
+const sendMessageWithEvent = (msg, event, fields) => {
+  msg.args = Object.assign({ args: msg.args === undefined ? null : msg.args }, eventFields(event, fields));
+
+  console.log(`${SOCKET_MESSAGE}`, JSON.stringify(msg));
+  safeSend(msg);
+};
+
+// eventFields picks the requested properties out of an event
+function eventFields(event, fields) {
+  const target = event.target || {};
+  const picked = {};
+
+  fields.forEach(field => {
+    switch (field) {
+      case 'key':
+        picked.key = event.key;
+        picked.code = event.code;
+        break;
+      case 'modifiers':
+        picked.altKey = !!event.altKey;
+        picked.ctrlKey = !!event.ctrlKey;
+        picked.shiftKey = !!event.shiftKey;
+        picked.metaKey = !!event.metaKey;
+        break;
+      case 'client':
+        picked.clientX = event.clientX;
+        picked.clientY = event.clientY;
+        break;
+      case 'offset':
+        picked.offsetX = event.offsetX;
+        picked.offsetY = event.offsetY;
+        break;
+      case 'dataset':
+        picked.dataset = Object.assign({}, target.dataset);
+        break;
+      case 'checked':
+        picked.checked = !!target.checked;
+        break;
+      case 'value':
+        picked.value = target.value;
+        break;
+      default:
+        console.warn(`Unknown event field: ${field}`);
+    }
+  });
 
-  const msgJsonString = JSON.stringify(msg);
-  console.log(`${SOCKET_MESSAGE}`, msgJsonString);
-  safeSend(msgJsonString);
+  return picked;
+}
+
+// Key filters run fn only for the key, e.g. "Enter" or "Ctrl+Shift+k".
+// Ctrl, Alt and Meta must match exactly; Shift is only checked when it is named,
+// since it is part of how characters like "?" are typed.
+const onKey = (event, combo, fn) => {
+  if (!matchesKey(event, combo)) {
+    return;
+  }
+
+  event.preventDefault();
+  fn();
 };
 
+function matchesKey(event, combo) {
+  // Split on the last "+" that isn't the key itself, so "+" and "Ctrl++" work
+  const split = combo.length > 1 ? combo.lastIndexOf('+', combo.length - 2) : -1;
+  const key = split < 0 ? combo : combo.slice(split + 1);
+  const modifiers = split < 0 ? [] : combo.slice(0, split).split('+').map(part => part.toLowerCase());
+
+  if (!!event.ctrlKey !== modifiers.includes('ctrl') ||
+      !!event.altKey !== modifiers.includes('alt') ||
+      !!event.metaKey !== modifiers.includes('meta')) {
+    return false;
+  }
+  if (modifiers.includes('shift') && !event.shiftKey) {
+    return false;
+  }
+
+  return (event.key || '').toLowerCase() === key.toLowerCase();
+}
+
 // Submit a form through the websocket
 const updateFormState = (msg, formID) => {
   msg.args = serializeForm(formID);
 
   console.log(`${SOCKET_MESSAGE}`, msg);
-  safeSend(JSON.stringify(msg));
+  safeSend(msg);
 };
 
 
+// Calls are messages which expect a reply.
+// gotea.call returns a Promise, which resolves with the reply from the handler,
+// or rejects if the handler fails or the reply doesn't arrive in time.
+let nextCallId = 1;
+const pendingCalls = new Map();
+
+const call = (message, args, options = {}) => new Promise((resolve, reject) => {
+  const callId = nextCallId++;
+  const timeout = setTimeout(() => {
+    pendingCalls.delete(callId);
+    reject(new Error(`Call ${message} timed out`));
+  }, options.timeout || DEFAULT_CALL_TIMEOUT);
+
+  pendingCalls.set(callId, { resolve, reject, timeout });
+  sendMessage({ message, args, callId });
+});
+
+function settleCall(frame) {
+  const pending = pendingCalls.get(frame.id);
+  if (!pending) return; // Already timed out
+
+  pendingCalls.delete(frame.id);
+  clearTimeout(pending.timeout);
+
+  if (frame.error) {
+    pending.reject(new Error(frame.error));
+  } else {
+    pending.resolve(frame.payload);
+  }
+}
+
 // Serialize form data into an object
 const serializeForm = formID => {
   const formElements = [...document.getElementById(formID).elements];
@@ -205,6 +1126,248 @@ const serializeForm = formID => {
   }, {});
 };
 
+// Rate limiting for fast-firing events.
+// Timing is kept per element and event type, so e.g. two search boxes don't hold back each other.
+const rateLimiters = new WeakMap();
+
+function getRateLimiter(el, event) {
+  const eventType = event ? event.type : '';
+  let limiters = rateLimiters.get(el);
+  if (!limiters) {
+    limiters = new Map();
+    rateLimiters.set(el, limiters);
+  }
+  if (!limiters.has(eventType)) {
+    limiters.set(eventType, { timeout: null, last: 0, pending: null });
+  }
+  return limiters.get(eventType);
+}
+
+// Run fn once the event has stopped firing for delay ms
+const debounce = (el, event, delay, fn) => {
+  const limiter = getRateLimiter(el, event);
+  clearTimeout(limiter.timeout);
+  limiter.timeout = setTimeout(() => {
+    limiter.timeout = null;
+    withOrigin(el, fn);
+  }, delay);
+};
+
+// Run fn at most once every delay ms - straight away if possible,
+// otherwise with the latest call once the delay is up
+const throttle = (el, event, delay, fn) => {
+  const limiter = getRateLimiter(el, event);
+  const remaining = delay - (Date.now() - limiter.last);
+
+  if (remaining <= 0 && !limiter.timeout) {
+    limiter.last = Date.now();
+    withOrigin(el, fn);
+    return;
+  }
+
+  limiter.pending = fn;
+  if (!limiter.timeout) {
+    limiter.timeout = setTimeout(() => {
+      limiter.timeout = null;
+      limiter.last = Date.now();
+      withOrigin(el, limiter.pending);
+    }, remaining);
+  }
+};
+
+// Client JS.
+// Lists of operations built with gt.JS, run from a handler without a round trip to the server.
+// Each operation is [name, args], and targets the element with args.id, or the handler's own element.
+const jsOps = {
+  addClass: (el, args) => args.classes.forEach(name => setClientChange(el, `class:${name}`, true)),
+  removeClass: (el, args) => args.classes.forEach(name => setClientChange(el, `class:${name}`, false)),
+  toggleClass: (el, args) => args.classes.forEach(name => setClientChange(el, `class:${name}`, !el.classList.contains(name))),
+  show: el => setClientChange(el, 'display', shownDisplay(el)),
+  hide: el => setClientChange(el, 'display', 'none'),
+  toggle: el => setClientChange(el, 'display', getComputedStyle(el).display === 'none' ? shownDisplay(el) : 'none'),
+  setAttr: (el, args) => setClientChange(el, `attr:${args.name}`, args.value),
+  removeAttr: (el, args) => setClientChange(el, `attr:${args.name}`, null),
+  focus: el => el.focus(),
+  send: (el, args) => sendMessage(Object.assign({}, args.message))
+};
+
+const exec = (el, ops) => {
+  ops.forEach(([name, args]) => {
+    const op = jsOps[name];
+    if (!op) {
+      console.warn(`Unknown JS operation: ${name}`);
+      return;
+    }
+
+    const target = args.id ? document.getElementById(args.id) : el;
+    if (!target) {
+      console.warn(`Could not run ${name} on #${args.id}: not found`);
+      return;
+    }
+    op(target, args);
+  });
+};
+
+// shownDisplay is the display which makes the element visible - its own, unless a class hides it
+function shownDisplay(el) {
+  const previous = el.style.display;
+  el.style.display = '';
+  const display = getComputedStyle(el).display === 'none' ? 'block' : '';
+  el.style.display = previous;
+  return display;
+}
+
+// Changes made by client JS are remembered per element, along with what the server had rendered,
+// so they can be carried over when the server renders again.  Once the server renders something
+// different for the same class or attribute, it has taken ownership and the client change is dropped.
+// Keys are "class:<name>", "attr:<name>" or "display".
+const clientChanges = new WeakMap();
+
+function readClientChange(el, key) {
+  if (key === 'display') return el.style.display;
+  if (key.startsWith('class:')) return el.classList.contains(key.slice(6));
+  return el.getAttribute(key.slice(5));
+}
+
+function writeClientChange(el, key, value) {
+  if (key === 'display') {
+    el.style.display = value;
+  } else if (key.startsWith('class:')) {
+    el.classList.toggle(key.slice(6), value);
+  } else if (value === null) {
+    el.removeAttribute(key.slice(5));
+  } else {
+    el.setAttribute(key.slice(5), value);
+  }
+}
+
+function setClientChange(el, key, value) {
+  let changes = clientChanges.get(el);
+  if (!changes) {
+    changes = new Map();
+    clientChanges.set(el, changes);
+  }
+
+  const existing = changes.get(key);
+  changes.set(key, { value, server: existing ? existing.server : readClientChange(el, key) });
+  writeClientChange(el, key, value);
+}
+
+// revertClientChange puts back what the server rendered
+function revertClientChange(el, key) {
+  const changes = clientChanges.get(el);
+  const change = changes && changes.get(key);
+  if (!change) return;
+
+  changes.delete(key);
+  writeClientChange(el, key, change.server);
+}
+
+function preserveClientChanges(fromEl, toEl) {
+  const changes = clientChanges.get(fromEl);
+  if (!changes) return;
+
+  changes.forEach((change, key) => {
+    if (readClientChange(toEl, key) !== change.server) {
+      changes.delete(key);
+      return;
+    }
+    writeClientChange(toEl, key, change.value);
+  });
+}
+
+// Delegated bindings.
+// data-gotea-<event> attributes hold a JSON description of the message to send,
+// so pages don't need inline event handlers and can run under a strict Content-Security-Policy.
+// Most events are handled as they bubble to the document, firing the binding on every element
+// from the target upwards, just as inline handlers would.  Events which don't bubble are
+// caught on the way down, and only fire the binding on their target.
+const BINDING_PREFIX = 'data-gotea-';
+const BUBBLING_BINDINGS = [
+  'click', 'dblclick', 'contextmenu', 'input', 'change', 'submit', 'reset',
+  'keydown', 'keyup', 'keypress', 'focusin', 'focusout',
+  'mousedown', 'mouseup', 'mouseover', 'mouseout', 'mousemove',
+  'pointerdown', 'pointerup', 'pointermove', 'touchstart', 'touchend', 'wheel',
+  'dragstart', 'dragend', 'dragover', 'dragleave', 'drop'
+];
+const TARGET_BINDINGS = ['focus', 'blur', 'mouseenter', 'mouseleave', 'scroll', 'load', 'error'];
+
+function handleBinding(event) {
+  const attribute = BINDING_PREFIX + event.type;
+  const target = event.target;
+
+  if (TARGET_BINDINGS.includes(event.type)) {
+    if (target instanceof Element && target.hasAttribute(attribute)) {
+      runBinding(target, event, target.getAttribute(attribute));
+    }
+    return;
+  }
+
+  const selector = `[${attribute}]`;
+  let el = target instanceof Element ? target.closest(selector) : null;
+  while (el) {
+    runBinding(el, event, el.getAttribute(attribute));
+    el = el.parentElement && el.parentElement.closest(selector);
+  }
+}
+
+function runBinding(el, event, json) {
+  let binding;
+  try {
+    binding = JSON.parse(json);
+  } catch (e) {
+    console.warn(`Invalid binding on ${event.type}:`, json);
+    return;
+  }
+
+  const { input, thisInput, form, fields, key, ops, debounce: debounceDelay, throttle: throttleDelay, ...msg } = binding;
+
+  if (key) {
+    if (!matchesKey(event, key)) {
+      return;
+    }
+    event.preventDefault();
+  }
+  if (event.type === 'submit') {
+    event.preventDefault();
+  }
+
+  if (ops) {
+    withOrigin(el, () => exec(el, ops));
+  }
+  // A binding may only run client JS
+  if (!msg.message) {
+    return;
+  }
+
+  // Event properties are read now, but input values when the message is finally sent
+  const picked = fields ? eventFields(event, fields) : null;
+  const send = () => {
+    if (form) {
+      msg.args = serializeForm(form);
+    } else if (input) {
+      msg.args = document.getElementById(input).value;
+    } else if (thisInput) {
+      msg.args = el.value;
+    }
+    if (picked) {
+      msg.args = Object.assign({ args: msg.args === undefined ? null : msg.args }, picked);
+    }
+    sendMessage(msg);
+  };
+
+  if (debounceDelay) {
+    debounce(el, event, debounceDelay, send);
+  } else if (throttleDelay) {
+    throttle(el, event, throttleDelay, send);
+  } else {
+    withOrigin(el, send);
+  }
+}
+
+BUBBLING_BINDINGS.forEach(type => document.addEventListener(type, handleBinding));
+TARGET_BINDINGS.forEach(type => document.addEventListener(type, handleBinding, true));
+
 // Change the route and notify the server
 const changeRoute = route => {
   history.pushState({}, "", route);
@@ -213,7 +1376,7 @@ const changeRoute = route => {
     args: route
   };
   console.log(`${SOCKET_MESSAGE}`, msg);
-  safeSend(JSON.stringify(msg));
+  safeSend(msg);
 };
 
 // Expose functions to the global window object
@@ -221,9 +1384,34 @@ window.gotea = {
   sendMessage,
   updateFormState,
   sendMessageWithValueFromInput,
-  sendMessageWithValueFromThisInput
+  sendMessageWithValueFromThisInput,
+  sendMessageWithEvent,
+  onKey,
+  exec,
+  debounce,
+  throttle,
+  registerCommand,
+  registerHook,
+  on,
+  call,
+  registerQuery,
+  // Dev mode turns on checks which are too costly for production, such as for duplicate keys.
+  // It is on when the page is served from this machine, and apps can turn it on or off with gotea.devMode = ...
+  devMode: ['localhost', '127.0.0.1', '[::1]'].includes(location.hostname)
 };
 
+// Mount hooks on the page as served, once it has loaded
+function onPageLoad() {
+  mountHooks();
+  checkKeys();
+}
+
+if (document.readyState === 'loading') {
+  document.addEventListener('DOMContentLoaded', onPageLoad);
+} else {
+  onPageLoad();
+}
+
 // Handle browser back/forward navigation
 window.addEventListener('popstate', event => {
   const msg = {
@@ -231,7 +1419,7 @@ window.addEventListener('popstate', event => {
     args: document.location.pathname,
   };
   console.log(`${SOCKET_MESSAGE}`, msg);
-  safeSend(JSON.stringify(msg));
+  safeSend(msg);
 });
 
 // Intercept link clicks and handle routing
@@ -0,0 +1,205 @@
+package gotea
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/olahol/melody"
+)
+
+// PROTOCOL
+
+// Every frame sent from the runtime to gotea.js is a JSON envelope, tagged with its type:
+//
+//	{"t": "hello", "v": 1, "lastSeq": 0, "resumed": false}
+//	{"t": "render", "html": "..."}
+//	{"t": "patch", "id": "...", "html": "..."}
+//	{"t": "snapshot", "data": "..."}
+//	{"t": "cmd", "cmd": "...", "args": {...}}
+//	{"t": "error", "html": "..."}
+//	{"t": "event", "name": "...", "target": "...", "payload": ...}
+//	{"t": "reply", "id": 1, "payload": ..., "error": "..."}
+//	{"t": "ack", "seq": 1}
+//	{"t": "drop", "seq": 4}
+//	{"t": "ping", "id": 1, "latency": 12.5}
+//
+// Frames gotea.js doesn't recognise are ignored, so new types can be added without breaking older clients.
+// Changes that older clients can't ignore mean bumping ProtocolVersion.
+
+// ProtocolVersion is the version of the frame protocol spoken by this runtime.
+// gotea.js sends its own version when connecting, and a mismatch - typically
+// a tab that loaded its JS before a deploy - makes the tab reload.
+const ProtocolVersion = 1
+
+const (
+	frameHello    = "hello"
+	frameRender   = "render"
+	framePatch    = "patch"
+	frameSnapshot = "snapshot"
+	frameCmd      = "cmd"
+	frameError    = "error"
+	frameEvent    = "event"
+	frameReply    = "reply"
+	frameAck      = "ack"
+	frameDrop     = "drop"
+	framePing     = "ping"
+)
+
+const (
+	// protocolVersionParam is the query parameter gotea.js uses to send its protocol version
+	protocolVersionParam = "v"
+
+	// cmdReload tells the client to reload the page
+	cmdReload = "reload"
+	// cmdReplaceRoute tells the client to replace its current URL, without triggering another route change
+	cmdReplaceRoute = "replaceRoute"
+)
+
+// writeFrame wraps the fields in an envelope of the frame type and sends it
+func writeFrame(s *melody.Session, frameType string, fields map[string]any) {
+	frame := map[string]any{"t": frameType}
+	for k, v := range fields {
+		frame[k] = v
+	}
+
+	jsonFrame, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Could not encode %s frame: %v", frameType, err)
+		return
+	}
+
+	unsent := unsentFrameCounter(s)
+	if unsent != nil {
+		unsent.Add(1)
+	}
+	if err := s.Write(jsonFrame); err != nil && unsent != nil {
+		unsent.Add(-1)
+	}
+}
+
+// Melody queues each connection's frames in a buffer, and drops new ones once it is full.
+// The frames written to a connection but not yet sent are counted, so a session can hold
+// back its next flush while the last one is still queued, rather than have it dropped.
+const melodyUnsentFramesKey = "unsentFrames"
+
+// trackFrames starts counting the connection's unsent frames.  It must be called before anything is written.
+func trackFrames(s *melody.Session) {
+	s.Set(melodyUnsentFramesKey, new(atomic.Int64))
+}
+
+func unsentFrameCounter(s *melody.Session) *atomic.Int64 {
+	unsent, exists := s.Get(melodyUnsentFramesKey)
+	if !exists {
+		return nil
+	}
+	return unsent.(*atomic.Int64)
+}
+
+// unsentFrames is the number of frames written to the connection which melody hasn't sent yet
+func unsentFrames(s *melody.Session) int64 {
+	if unsent := unsentFrameCounter(s); unsent != nil {
+		return unsent.Load()
+	}
+	return 0
+}
+
+// frameDone records that one of the connection's frames has left the buffer, reporting how many remain
+func frameDone(s *melody.Session) int64 {
+	if unsent := unsentFrameCounter(s); unsent != nil {
+		return unsent.Add(-1)
+	}
+	return 0
+}
+
+// writeCmd sends a command for gotea.js to carry out
+func writeCmd(s *melody.Session, cmd string, args map[string]any) {
+	writeFrame(s, frameCmd, map[string]any{"cmd": cmd, "args": args})
+}
+
+// writeHello completes the handshake.  As well as the protocol version, it tells the client
+// the last message sequence number processed by this session, so it knows which of its
+// queued messages to replay.
+func writeHello(s *melody.Session, lastSeq uint64, resumed bool) {
+	writeFrame(s, frameHello, map[string]any{
+		"v":       ProtocolVersion,
+		"lastSeq": lastSeq,
+		"resumed": resumed,
+	})
+}
+
+func writeRender(s *melody.Session, html []byte) {
+	writeFrame(s, frameRender, map[string]any{"html": string(html)})
+}
+
+func writeError(s *melody.Session, html []byte) {
+	writeFrame(s, frameError, map[string]any{"html": string(html)})
+}
+
+// writePatch tells the client to replace a single element
+func writePatch(s *melody.Session, p patch) {
+	writeFrame(s, framePatch, map[string]any{"id": p.id, "html": string(p.html)})
+}
+
+// writeEvent sends an event to listeners in the browser
+func writeEvent(s *melody.Session, e clientEvent) {
+	writeFrame(s, frameEvent, map[string]any{"name": e.name, "target": e.target, "payload": e.payload})
+}
+
+// writeReply answers a call from gotea.call, which is rejected if there is an error
+func writeReply(s *melody.Session, callID uint64, payload any, err error) {
+	fields := map[string]any{"id": callID, "payload": payload}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	writeFrame(s, frameReply, fields)
+}
+
+// writeAck tells the client that every message up to and including seq has been processed
+func writeAck(s *melody.Session, seq uint64) {
+	writeFrame(s, frameAck, map[string]any{"seq": seq})
+}
+
+// writeDrop tells the client that the message with seq won't be processed, so it stops waiting for it.
+// Unlike an ack, it says nothing about the messages before it.
+func writeDrop(s *melody.Session, seq uint64) {
+	writeFrame(s, frameDrop, map[string]any{"seq": seq})
+}
+
+// writePing asks the client to answer with a pong.  It carries the latency
+// measured by the previous ping, in milliseconds, so the page can show it.
+func writePing(s *melody.Session, id uint64, latency time.Duration) {
+	writeFrame(s, framePing, map[string]any{"id": id, "latency": float64(latency) / float64(time.Millisecond)})
+}
+
+func writeSnapshot(s *melody.Session, snapshot []byte) {
+	writeFrame(s, frameSnapshot, map[string]any{"data": string(snapshot)})
+}
+
+// writeReplaceRoute tells the client to replace its current URL, without triggering another route change
+func writeReplaceRoute(s *melody.Session, route string) {
+	writeCmd(s, cmdReplaceRoute, map[string]any{"route": route})
+}
+
+// checkProtocolVersion reports whether the client connecting speaks the same protocol.
+// If not, it tells the client to reload, so it picks up the matching gotea.js.
+func checkProtocolVersion(s *melody.Session) bool {
+	clientVersion := s.Request.URL.Query().Get(protocolVersionParam)
+	if clientVersion == strconv.Itoa(ProtocolVersion) {
+		return true
+	}
+
+	log.Printf("Client protocol version '%s' does not match %d, asking client to reload", clientVersion, ProtocolVersion)
+
+	if clientVersion == "" {
+		// Clients from before the envelope protocol render any frame they can't parse as HTML
+		s.Write([]byte(`<body><p>This page is out of date. Please <a href="" class="external">reload</a>.</p></body>`))
+		return false
+	}
+
+	writeCmd(s, cmdReload, map[string]any{"v": ProtocolVersion})
+	return false
+}
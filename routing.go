@@ -0,0 +1,536 @@
+package gotea
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// maxRouteRedirects stops guards that redirect to each other from looping forever
+	maxRouteRedirects = 10
+
+	// routeParamPrefix marks a path segment as a parameter, e.g. /users/:id
+	routeParamPrefix = ":"
+)
+
+// ROUTING
+
+// Router is embedded by the application model to provide routing functionality
+type Router struct {
+	Route  string
+	routes map[string]*route
+	names  map[string]string
+	groups []*RouteGroup
+
+	notFoundHandler  RouteHandler
+	forbiddenHandler RouteHandler
+
+	status RouteStatus
+}
+
+type RouteHandler func(State) []byte
+
+// Layout wraps the rendered output of the route handlers in a group,
+// e.g. with a shared sidebar or header
+type Layout func(state State, children []byte) []byte
+
+// route is a registered handler, along with the guards inherited from the groups
+// it was registered through, and the innermost of those groups, whose layouts wrap it
+type route struct {
+	handler RouteHandler
+	guards  []RouteGuard
+	group   *RouteGroup
+}
+
+func (r *Router) SetNewRoute(route string) {
+	r.Route = route
+}
+
+func (r *Router) Register(path string, handler RouteHandler) {
+	r.register("", path, handler, nil, nil)
+}
+
+// RegisterNamed registers a route under a name, so that links to it can be built with URL
+func (r *Router) RegisterNamed(name, path string, handler RouteHandler) {
+	r.register(name, path, handler, nil, nil)
+}
+
+func (r *Router) register(name, path string, handler RouteHandler, guards []RouteGuard, group *RouteGroup) {
+	if r.routes == nil {
+		r.routes = make(map[string]*route)
+	}
+	r.routes[path] = &route{
+		handler: handler,
+		guards:  guards,
+		group:   group,
+	}
+
+	if name != "" {
+		if r.names == nil {
+			r.names = make(map[string]string)
+		}
+		r.names[name] = path
+	}
+}
+
+// SetNotFoundHandler sets the handler that is rendered when the current route is not registered
+func (r *Router) SetNotFoundHandler(handler RouteHandler) {
+	r.notFoundHandler = handler
+}
+
+// SetForbiddenHandler sets the handler that is rendered when a guard forbids the current route
+func (r *Router) SetForbiddenHandler(handler RouteHandler) {
+	r.forbiddenHandler = handler
+}
+
+func (r Router) RenderRoute(state State) []byte {
+	rt, _, ok := r.match(routePath(r.Route))
+	if !ok {
+		if r.notFoundHandler != nil {
+			return r.notFoundHandler(state)
+		}
+		return []byte("404 Not Found")
+	}
+
+	// Guards are checked again at render time, since the state they depend on
+	// (e.g. a logged in user) may have changed since the route was entered.
+	// Redirects can only be followed on a route change, so here anything
+	// other than 'allow' renders as forbidden.
+	if !runGuards(rt.guards, state).allowed() {
+		if r.forbiddenHandler != nil {
+			return r.forbiddenHandler(state)
+		}
+		return []byte("403 Forbidden")
+	}
+
+	// Layouts are applied innermost first, so that the outermost group wraps everything
+	content := rt.handler(state)
+	layouts := rt.group.allLayouts()
+	for i := len(layouts) - 1; i >= 0; i-- {
+		content = layouts[i](state, content)
+	}
+
+	return content
+}
+
+// CheckRoute runs the guards that apply to the specified route against the state
+func (r Router) CheckRoute(state State, newRoute string) GuardResult {
+	path := routePath(newRoute)
+
+	if rt, _, ok := r.match(path); ok {
+		return runGuards(rt.guards, state)
+	}
+
+	// Unregistered routes are still covered by the guards of the group they fall under,
+	// so that e.g. /admin/anything can't be probed without passing the /admin guards
+	var deepest *RouteGroup
+	for _, g := range r.groups {
+		if g.contains(path) && (deepest == nil || len(g.prefix) > len(deepest.prefix)) {
+			deepest = g
+		}
+	}
+
+	if deepest != nil {
+		return runGuards(deepest.guards, state)
+	}
+
+	return GuardAllow()
+}
+
+func (r Router) RouteParam(param string) string {
+	rel, err := url.Parse(r.Route)
+	if err != nil {
+		return ""
+	}
+
+	return rel.Query().Get(param)
+}
+
+// PathParam returns the value of a parameter segment in the current route,
+// e.g. the id in /users/:id
+func (r Router) PathParam(param string) string {
+	_, params, _ := r.match(routePath(r.Route))
+	return params[param]
+}
+
+func (r Router) GetRoute() string {
+	return r.Route
+}
+
+// HasRoute reports whether a route (with or without query string) matches a registered path
+func (r Router) HasRoute(route string) bool {
+	_, _, ok := r.match(routePath(route))
+	return ok
+}
+
+// match finds the registered route for a path.  Exact matches are preferred,
+// and after that the pattern with the fewest parameter segments wins.
+// Ties go to the pattern whose first literal segment comes earliest, e.g. /users/:id beats /:section/new,
+// so the result never depends on the order the map is iterated in.
+func (r Router) match(path string) (*route, map[string]string, bool) {
+	if rt, ok := r.routes[path]; ok {
+		return rt, map[string]string{}, true
+	}
+
+	var (
+		bestRoute    *route
+		bestParams   map[string]string
+		bestSegments []string
+	)
+
+	pathSegments := strings.Split(path, "/")
+	for pattern, rt := range r.routes {
+		patternSegments := strings.Split(pattern, "/")
+		params, ok := matchPattern(patternSegments, pathSegments)
+		if ok && (bestRoute == nil || moreSpecific(patternSegments, len(params), bestSegments, len(bestParams))) {
+			bestRoute, bestParams, bestSegments = rt, params, patternSegments
+		}
+	}
+
+	return bestRoute, bestParams, bestRoute != nil
+}
+
+// moreSpecific reports whether pattern a should be preferred to pattern b, when both match the same path
+func moreSpecific(a []string, aParamCount int, b []string, bParamCount int) bool {
+	if aParamCount != bParamCount {
+		return aParamCount < bParamCount
+	}
+
+	// Both match the same path, so they have the same number of segments
+	for i := range a {
+		aIsParam, bIsParam := strings.HasPrefix(a[i], routeParamPrefix), strings.HasPrefix(b[i], routeParamPrefix)
+		if aIsParam != bIsParam {
+			return bIsParam
+		}
+	}
+
+	// Only the parameter names differ, so any fixed order will do
+	return strings.Join(a, "/") < strings.Join(b, "/")
+}
+
+func matchPattern(patternSegments, pathSegments []string) (map[string]string, bool) {
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, routeParamPrefix) && pathSegments[i] != "" {
+			value, err := url.PathUnescape(pathSegments[i])
+			if err != nil {
+				return nil, false
+			}
+			params[strings.TrimPrefix(segment, routeParamPrefix)] = value
+		} else if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+
+	return params, true
+}
+
+// REVERSE ROUTING
+
+// RouteParams are substituted into the parameter segments of a named route.
+// Any that don't correspond to a segment are added to the query string.
+type RouteParams map[string]string
+
+// URL builds a link to a named route, returning an error if the name is unknown
+// or a parameter segment has not been supplied
+func (r Router) URL(name string, params RouteParams) (string, error) {
+	pattern, ok := r.names[name]
+	if !ok {
+		return "", fmt.Errorf("no route registered with name %s", name)
+	}
+
+	used := map[string]bool{}
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, routeParamPrefix) {
+			continue
+		}
+
+		param := strings.TrimPrefix(segment, routeParamPrefix)
+		value, ok := params[param]
+		if !ok || value == "" {
+			return "", fmt.Errorf("missing parameter %s for route %s (%s)", param, name, pattern)
+		}
+
+		segments[i] = url.PathEscape(value)
+		used[param] = true
+	}
+
+	link := strings.Join(segments, "/")
+
+	query := url.Values{}
+	for k, v := range params {
+		if !used[k] {
+			query.Set(k, v)
+		}
+	}
+
+	// Encode sorts by key, so the same params always produce the same link
+	if len(query) > 0 {
+		link = link + "?" + query.Encode()
+	}
+
+	return link, nil
+}
+
+// MustURL is like URL but panics on error.  It's intended for use in views,
+// where a broken link is a programming error that tests should catch.
+func (r Router) MustURL(name string, params RouteParams) string {
+	link, err := r.URL(name, params)
+	if err != nil {
+		panic(err)
+	}
+
+	return link
+}
+
+// routePath strips any query string from a route so it can be matched against registered paths.
+// The path is left escaped, so that an encoded slash in a parameter doesn't split the segment.
+func routePath(route string) string {
+	rel, err := url.Parse(route)
+	if err != nil {
+		return route
+	}
+
+	return rel.EscapedPath()
+}
+
+// HTTP STATUS
+
+// RouteStatus describes the HTTP response for the initial server render of a route.
+// It can be set from OnRouteChange or from within a route handler, and is ignored
+// once the websocket has taken over.  It starts afresh on every route change.
+// If no code is set, unregistered routes respond 404 (as long as any routes are registered) and forbidden routes 403.
+type RouteStatus struct {
+	Code      int
+	Header    http.Header
+	Canonical string
+}
+
+// httpResponder is fulfilled by embedding the Router, and lets the
+// initial HTTP render report the status of the route
+type httpResponder interface {
+	HasRoute(string) bool
+	HTTPStatus() RouteStatus
+	hasRoutes() bool
+	resetStatus()
+}
+
+// SetStatus sets the HTTP status code for the initial render, e.g. a 404 for a missing record
+func (r *Router) SetStatus(code int) {
+	r.status.Code = code
+}
+
+// SetHeader sets a response header for the initial render
+func (r *Router) SetHeader(key, value string) {
+	if r.status.Header == nil {
+		r.status.Header = http.Header{}
+	}
+	r.status.Header.Set(key, value)
+}
+
+// SetCanonical sets the canonical path for the current page, e.g. /users/jane, without a host or query string.
+// If the initial request was for a different path, it is permanently redirected to the canonical one,
+// keeping its query string.
+func (r *Router) SetCanonical(route string) {
+	r.status.Canonical = route
+}
+
+// HTTPStatus returns the status set for the initial render
+func (r Router) HTTPStatus() RouteStatus {
+	return r.status
+}
+
+// hasRoutes reports whether any routes are registered.  Apps which route by hand
+// in OnRouteChange register none, so the router can't tell which of their routes exist.
+func (r Router) hasRoutes() bool {
+	return len(r.routes) > 0
+}
+
+// resetStatus clears the status set for the previous route
+func (r *Router) resetStatus() {
+	r.status = RouteStatus{}
+}
+
+// ROUTE GROUPS
+
+// RouteGroup is a set of routes sharing a path prefix, guards and layouts.
+// Groups can be nested, in which case they inherit the guards and layouts of their parent.
+type RouteGroup struct {
+	router  *Router
+	parent  *RouteGroup
+	prefix  string
+	guards  []RouteGuard
+	layouts []Layout
+}
+
+// Group creates a new route group under the specified prefix, protected by the optional guards
+func (r *Router) Group(prefix string, guards ...RouteGuard) *RouteGroup {
+	g := &RouteGroup{
+		router: r,
+		prefix: joinPaths("", prefix),
+		guards: guards,
+	}
+	r.groups = append(r.groups, g)
+	return g
+}
+
+// Group creates a nested group, which runs its parent's guards before its own
+// and is wrapped in its parent's layouts
+func (g *RouteGroup) Group(prefix string, guards ...RouteGuard) *RouteGroup {
+	nested := &RouteGroup{
+		router: g.router,
+		parent: g,
+		prefix: joinPaths(g.prefix, prefix),
+		guards: appendCopy(g.guards, guards...),
+	}
+	g.router.groups = append(g.router.groups, nested)
+	return nested
+}
+
+// WithLayout adds a layout which wraps every route in the group and the groups nested in it,
+// whether they were registered before or after the layout was added
+func (g *RouteGroup) WithLayout(layout Layout) *RouteGroup {
+	g.layouts = append(g.layouts, layout)
+	return g
+}
+
+// allLayouts returns the layouts of the group and its parents, outermost first.
+// They are looked up at render time, so a layout added after a route was registered still wraps it.
+func (g *RouteGroup) allLayouts() []Layout {
+	if g == nil {
+		return nil
+	}
+	return appendCopy(g.parent.allLayouts(), g.layouts...)
+}
+
+// Register registers a handler at the specified path, relative to the group prefix
+func (g *RouteGroup) Register(path string, handler RouteHandler) {
+	g.RegisterNamed("", path, handler)
+}
+
+// RegisterNamed registers a named handler at the specified path, relative to the group prefix
+func (g *RouteGroup) RegisterNamed(name, path string, handler RouteHandler) {
+	g.router.register(
+		name,
+		joinPaths(g.prefix, path),
+		handler,
+		appendCopy(g.guards),
+		g,
+	)
+}
+
+// contains reports whether a path falls under the group prefix
+func (g *RouteGroup) contains(path string) bool {
+	return path == g.prefix || strings.HasPrefix(path, strings.TrimSuffix(g.prefix, "/")+"/")
+}
+
+func joinPaths(prefix, path string) string {
+	joined := strings.TrimSuffix(prefix, "/") + "/" + strings.Trim(path, "/")
+	if len(joined) > 1 {
+		joined = strings.TrimSuffix(joined, "/")
+	}
+	return joined
+}
+
+// ROUTE GUARDS
+
+// RouteGuard is run before a route in a group is entered or rendered,
+// and decides whether to allow it, redirect elsewhere or render forbidden
+type RouteGuard func(State) GuardResult
+
+// GuardResult is the decision made by a RouteGuard
+type GuardResult struct {
+	Redirect  string
+	Forbidden bool
+}
+
+// GuardAllow lets the route proceed
+func GuardAllow() GuardResult {
+	return GuardResult{}
+}
+
+// GuardRedirect sends the user to another route instead, e.g. a login page
+func GuardRedirect(route string) GuardResult {
+	return GuardResult{Redirect: route}
+}
+
+// GuardForbid renders the forbidden handler in place of the route
+func GuardForbid() GuardResult {
+	return GuardResult{Forbidden: true}
+}
+
+func (g GuardResult) allowed() bool {
+	return g.Redirect == "" && !g.Forbidden
+}
+
+// runGuards runs guards in order, stopping at the first one that doesn't allow the route
+func runGuards(guards []RouteGuard, state State) GuardResult {
+	for _, guard := range guards {
+		if result := guard(state); !result.allowed() {
+			return result
+		}
+	}
+
+	return GuardAllow()
+}
+
+// Routable will be fulfilled by the applicaiton model by embedding the Router
+// and defining the OnRouteChange function
+type Routable interface {
+	// These methods are fulfilled just by embedding the Router struct
+	SetNewRoute(string)
+	GetRoute() string
+	RouteParam(string) string
+	CheckRoute(State, string) GuardResult
+
+	// OnRouteChange must be defined by the user.  It is a routing function that determines the template to use as well as any logic to perform based on the route.
+	OnRouteChange(string)
+}
+
+// Messages relating to routing that will be merged into the main message map
+var routingMessages = MessageMap{
+	"CHANGE_ROUTE": changeRouteMsgHandler,
+}
+
+// changeRouteMsgHandler is the built in message handler which is fired when a
+// navigation event is detected
+func changeRouteMsgHandler(message Message, state State) Response {
+	requestedRoute := message.Arguments.(string)
+	newRoute := changeRoute(state, requestedRoute)
+
+	// If a guard redirected us, the browser's URL needs to be brought into line
+	if newRoute != requestedRoute {
+		return Response{replaceRoute: newRoute}
+	}
+
+	return Respond()
+}
+
+// changeRoute is fired both by the route change message handler and on establishment
+// of a new state blob.  It runs any guards, fires the app-provided routing logic and sets the new route /// on the model.
+// The route that was actually entered is returned, which will differ from the one requested if a guard redirected.
+func changeRoute(state State, newRoute string) string {
+	for i := 0; i < maxRouteRedirects; i++ {
+		result := state.CheckRoute(state, newRoute)
+		if result.Redirect == "" || result.Redirect == newRoute {
+			break
+		}
+		newRoute = result.Redirect
+	}
+
+	// The status, headers and canonical path belong to the route they were set for
+	if responder, ok := state.(httpResponder); ok {
+		responder.resetStatus()
+	}
+
+	state.OnRouteChange(newRoute)
+	state.SetNewRoute(newRoute)
+	return newRoute
+}
@@ -0,0 +1,208 @@
+package gotea
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type testModel struct {
+	Router
+	LoggedIn bool
+	IsAdmin  bool
+}
+
+func (m *testModel) Init(uuid.UUID) State     { return m }
+func (m *testModel) Update() MessageMap       { return MessageMap{} }
+func (m *testModel) Render() []byte           { return m.RenderRoute(m) }
+func (m *testModel) RenderError(error) []byte { return nil }
+func (m *testModel) OnRouteChange(string)     {}
+
+func requireLogin(s State) GuardResult {
+	if !s.(*testModel).LoggedIn {
+		return GuardRedirect("/login")
+	}
+	return GuardAllow()
+}
+
+func requireAdmin(s State) GuardResult {
+	if !s.(*testModel).IsAdmin {
+		return GuardForbid()
+	}
+	return GuardAllow()
+}
+
+func handlerWithOutput(output string) RouteHandler {
+	return func(State) []byte {
+		return []byte(output)
+	}
+}
+
+func layoutWithTag(tag string) Layout {
+	return func(_ State, children []byte) []byte {
+		return []byte("<" + tag + ">" + string(children) + "</" + tag + ">")
+	}
+}
+
+func newTestRouterModel() *testModel {
+	m := &testModel{}
+	m.Register("/", handlerWithOutput("home"))
+	m.Register("/login", handlerWithOutput("login"))
+
+	account := m.Group("/account", requireLogin).WithLayout(layoutWithTag("account"))
+	account.Register("/", handlerWithOutput("account home"))
+	account.Register("/settings", handlerWithOutput("settings"))
+
+	admin := account.Group("/admin", requireAdmin).WithLayout(layoutWithTag("admin"))
+	admin.Register("/users", handlerWithOutput("users"))
+
+	return m
+}
+
+func TestRouteGuards(t *testing.T) {
+	testCases := []struct {
+		name           string
+		loggedIn       bool
+		isAdmin        bool
+		route          string
+		expectedRoute  string
+		expectedOutput string
+	}{
+		{"unguarded", false, false, "/", "/", "home"},
+		{"query string is ignored for matching", false, false, "/?q=1", "/?q=1", "home"},
+		{"redirected to login", false, false, "/account/settings", "/login", "login"},
+		{"unregistered route under group is guarded", false, false, "/account/nothing", "/login", "login"},
+		{"unregistered route outside group", false, false, "/nothing", "/nothing", "404 Not Found"},
+		{"group root with layout", true, false, "/account", "/account", "<account>account home</account>"},
+		{"nested layouts", true, true, "/account/admin/users", "/account/admin/users", "<account><admin>users</admin></account>"},
+		{"nested guard forbids", true, false, "/account/admin/users", "/account/admin/users", "403 Forbidden"},
+		{"outer guard runs first", false, true, "/account/admin/users", "/login", "login"},
+	}
+
+	for _, testCase := range testCases {
+		m := newTestRouterModel()
+		m.LoggedIn = testCase.loggedIn
+		m.IsAdmin = testCase.isAdmin
+
+		if route := changeRoute(m, testCase.route); route != testCase.expectedRoute {
+			t.Errorf("Test '%s' failed. Expected route %s, got %s", testCase.name, testCase.expectedRoute, route)
+		}
+
+		if output := string(m.Render()); output != testCase.expectedOutput {
+			t.Errorf("Test '%s' failed. Expected output %s, got %s", testCase.name, testCase.expectedOutput, output)
+		}
+	}
+}
+
+func TestRouteGuardsAtRenderTime(t *testing.T) {
+	m := newTestRouterModel()
+	m.SetForbiddenHandler(handlerWithOutput("custom forbidden"))
+	m.LoggedIn = true
+	changeRoute(m, "/account/settings")
+
+	// Logging out while on a guarded route should stop it rendering
+	m.LoggedIn = false
+	if output := string(m.Render()); output != "custom forbidden" {
+		t.Errorf("Expected forbidden handler to render after logout, got %s", output)
+	}
+}
+
+func TestLayoutAddedAfterRegistration(t *testing.T) {
+	m := &testModel{}
+	docs := m.Group("/docs")
+	docs.Register("/intro", handlerWithOutput("intro"))
+	api := docs.Group("/api")
+	api.Register("/users", handlerWithOutput("users"))
+
+	// Layouts wrap the group's routes, and its nested groups, whenever they were registered
+	docs.WithLayout(layoutWithTag("docs"))
+
+	changeRoute(m, "/docs/intro")
+	if output := string(m.Render()); output != "<docs>intro</docs>" {
+		t.Errorf("Expected layout to wrap route registered before it, got %s", output)
+	}
+
+	changeRoute(m, "/docs/api/users")
+	if output := string(m.Render()); output != "<docs>users</docs>" {
+		t.Errorf("Expected layout to wrap route in nested group, got %s", output)
+	}
+}
+
+func TestReverseRouting(t *testing.T) {
+	m := &testModel{}
+	m.RegisterNamed("home", "/", handlerWithOutput("home"))
+	m.RegisterNamed("user.show", "/users/:id", handlerWithOutput("user"))
+	m.Group("/teams").RegisterNamed("team.member", "/:team/members/:member", handlerWithOutput("member"))
+
+	testCases := []struct {
+		name        string
+		routeName   string
+		params      RouteParams
+		expected    string
+		expectError bool
+	}{
+		{"no params", "home", nil, "/", false},
+		{"single param", "user.show", RouteParams{"id": "42"}, "/users/42", false},
+		{"params are escaped", "user.show", RouteParams{"id": "a b/c"}, "/users/a%20b%2Fc", false},
+		{"extra params go to query string", "user.show", RouteParams{"id": "42", "tab": "posts", "page": "2"}, "/users/42?page=2&tab=posts", false},
+		{"grouped route", "team.member", RouteParams{"team": "red", "member": "7"}, "/teams/red/members/7", false},
+		{"missing param", "team.member", RouteParams{"team": "red"}, "", true},
+		{"unknown name", "user.edit", RouteParams{"id": "42"}, "", true},
+	}
+
+	for _, testCase := range testCases {
+		link, err := m.URL(testCase.routeName, testCase.params)
+		if testCase.expectError && err == nil {
+			t.Errorf("Test '%s' failed. Expected error, got %s", testCase.name, link)
+		}
+		if !testCase.expectError && err != nil {
+			t.Errorf("Test '%s' failed. Unexpected error: %v", testCase.name, err)
+		}
+		if link != testCase.expected {
+			t.Errorf("Test '%s' failed. Expected %s, got %s", testCase.name, testCase.expected, link)
+		}
+
+		// Every link we build should route back to where it came from
+		if err == nil && !m.HasRoute(link) {
+			t.Errorf("Test '%s' failed. Link %s does not resolve", testCase.name, link)
+		}
+	}
+
+	changeRoute(m, "/users/a%20b%2Fc?tab=posts")
+	if id := m.PathParam("id"); id != "a b/c" {
+		t.Errorf("Expected path param id to be 'a b/c', got %s", id)
+	}
+	if output := string(m.Render()); output != "user" {
+		t.Errorf("Expected parameterised route to render, got %s", output)
+	}
+}
+
+func TestRouteSpecificity(t *testing.T) {
+	testCases := []struct {
+		name           string
+		route          string
+		expectedOutput string
+	}{
+		{"exact match beats patterns", "/users/me", "me"},
+		{"fewer params beat more", "/users/42", "user"},
+		{"earlier literal breaks a tie", "/users/new", "user"},
+		{"later literal still beats a param", "/teams/new", "new"},
+		{"all params", "/teams/42", "any"},
+	}
+
+	for _, testCase := range testCases {
+		// Map iteration order varies, so give it a chance to pick differently
+		for i := 0; i < 50; i++ {
+			m := &testModel{}
+			m.Register("/users/me", handlerWithOutput("me"))
+			m.Register("/users/:id", handlerWithOutput("user"))
+			m.Register("/:section/new", handlerWithOutput("new"))
+			m.Register("/:section/:id", handlerWithOutput("any"))
+			changeRoute(m, testCase.route)
+
+			if output := string(m.Render()); output != testCase.expectedOutput {
+				t.Fatalf("Test '%s' failed. Expected output %s, got %s", testCase.name, testCase.expectedOutput, output)
+			}
+		}
+	}
+}
@@ -2,105 +2,24 @@ package gotea
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-	"net/url"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	h "github.com/jpincas/go-tea/html"
 	"github.com/olahol/melody"
 )
 
 const (
 	melodySessionDataKey = "sessionData"
-)
-
-// sessionData wraps the state with a mutex to prevent concurrent message processing
-// and caches the MessageMap to avoid rebuilding it on every message
-type sessionData struct {
-	state      State
-	mu         sync.Mutex
-	messageMap MessageMap // cached from state.Update()
-}
-
-// ROUTING
-
-// Router is embedded by the application model to provide routing functionality
-type Router struct {
-	Route  string
-	routes map[string]RouteHandler
-}
-
-type RouteHandler func(State) []byte
-
-func (r *Router) SetNewRoute(route string) {
-	r.Route = route
-}
-
-func (r *Router) Register(path string, handler RouteHandler) {
-	if r.routes == nil {
-		r.routes = make(map[string]RouteHandler)
-	}
-	r.routes[path] = handler
-}
-
-func (r Router) RenderRoute(state State) []byte {
-	handler, ok := r.routes[r.Route]
-	if !ok {
-		// Try to find a default route or return nil/error page
-		// For now, let's check if there is a "/" handler as fallback if exact match fails?
-		// Or maybe the user should register a 404 handler.
-		// Let's return nil and let the user handle it if they want, or maybe return a simple 404.
-		return []byte("404 Not Found")
-	}
-	return handler(state)
-}
-
-func (r Router) RouteParam(param string) string {
-	rel, err := url.Parse(r.Route)
-	if err != nil {
-		return ""
-	}
-
-	return rel.Query().Get(param)
-}
-
-func (r Router) GetRoute() string {
-	return r.Route
-}
-
-// Routable will be fulfilled by the applicaiton model by embedding the Router
-// and defining the OnRouteChange function
-type Routable interface {
-	// These methods are fulfilled just by embedding the Router struct
-	SetNewRoute(string)
-	GetRoute() string
-	RouteParam(string) string
+	sessionCookieName    = "session_id"
 
-	// OnRouteChange must be defined by the user.  It is a routing function that determines the template to use as well as any logic to perform based on the route.
-	OnRouteChange(string)
-}
-
-// Messages relating to routing that will be merged into the main message map
-var routingMessages = MessageMap{
-	"CHANGE_ROUTE": changeRouteMsgHandler,
-}
-
-// changeRouteMsgHandler is the built in message handler which is fired when a
-// navigation event is detected
-func changeRouteMsgHandler(message Message, state State) Response {
-	changeRoute(state, message.Arguments.(string))
-	return Respond()
-}
-
-// changeRoute is fired both by the route change message handler and on establishment
-// of a new state blob.  It fires the app-provided routing logic and sets the new route /// on the model.
-func changeRoute(state State, newRoute string) {
-	state.OnRouteChange(newRoute)
-	state.SetNewRoute(newRoute)
-}
+	contentTypeHeader = "Content-Type"
+	contentTypeHTML   = "text/html; charset=utf-8"
+)
 
 // STATE
 
@@ -134,50 +53,154 @@ type Persistable interface {
 
 // onConnect is the Melody handler that is called when a new session is established
 // It is responsible for setting up the initial state of the session, including routing
-func onConnect(model State) func(s *melody.Session) {
-	return func(s *melody.Session) {
-		// We need to get the session id from the cookie
-		cookie, err := s.Request.Cookie("session_id")
-		if err != nil {
-			log.Printf("Error getting session ID from cookie: %v", err)
-			return
-		}
+func (app *Application) onConnect(s *melody.Session) {
+	// A client speaking a different protocol is told to reload, and is never given a session
+	if !checkProtocolVersion(s) {
+		return
+	}
+	trackFrames(s)
+
+	// We need to get the session id from the cookie
+	cookie, err := s.Request.Cookie(sessionCookieName)
+	if err != nil {
+		log.Printf("Error getting session ID from cookie: %v", err)
+		return
+	}
 
+	// We can't just use the path from the URL, since the websocket
+	// connection is always through /server.
+	// Therefore, the JS adds a ?whence=route parameter to /server
+	// when making the connection, so we get the starting route from there
+	s.Request.ParseForm()
+	startingRoute := s.Request.URL.Query().Get("whence")
+
+	// If this connection follows an HTTP render, the JS passes back the token
+	// under which that state was parked, and we pick up where the render left off.
+	// Otherwise (e.g. on reconnect, or if the token has expired) we start from Init.
+	state, adopted := app.handoffs.claim(s.Request.URL.Query().Get("handoff"), cookie.Value)
+	if adopted {
+		// The tab has loaded a fresh page, so anything it left behind is stale
+		app.suspended.discard(suspendedKey(s.Request))
+	} else if sd, resumed := app.resume(s); resumed {
+		// A tab reconnecting within the grace period picks up its exact in-memory state
+		app.resumeSession(s, sd, startingRoute)
+		return
+	} else {
 		// Set the session ID on the state
-		state := model.Init(uuid.MustParse(cookie.Value))
-
-		// We can't just use the path from the URL, since the websocket
-		// connection is always through /server.
-		// Therefore, the JS adds a ?whence=route parameter to /server
-		// when making the connection, so we get the starting route from there
-		s.Request.ParseForm()
-		startingRoute := s.Request.URL.Query().Get("whence")
-		changeRoute(state, startingRoute)
-
-		// Check if client is sending restored state
-		restoredState := s.Request.URL.Query().Get("restored_state")
-		if restoredState != "" && restoredState != "null" {
-			if persistable, ok := state.(Persistable); ok {
-				if err := persistable.Deserialize([]byte(restoredState)); err != nil {
-					log.Printf("Failed to restore state: %v", err)
-					// Continue with fresh state
-				} else {
-					log.Printf("Successfully restored state for session %s", cookie.Value)
-					// If we restored state, we need to send the updated view to the client
-					// because the initial HTTP render would have been blank/default
-					s.Write(state.Render())
-				}
+		state = app.Model.Init(uuid.MustParse(cookie.Value))
+	}
+
+	if !adopted || state.GetRoute() != startingRoute {
+		if newRoute := changeRoute(state, startingRoute); newRoute != startingRoute {
+			writeReplaceRoute(s, newRoute)
+		}
+	}
+
+	// Check if client is sending restored state
+	restoredState := s.Request.URL.Query().Get("restored_state")
+	if restoredState != "" && restoredState != "null" {
+		if persistable, ok := state.(Persistable); ok {
+			if err := persistable.Deserialize([]byte(restoredState)); err != nil {
+				log.Printf("Failed to restore state: %v", err)
+				// Continue with fresh state
+			} else {
+				log.Printf("Successfully restored state for session %s", cookie.Value)
+				// If we restored state, we need to send the updated view to the client
+				// because the initial HTTP render would have been blank/default
+				writeRender(s, state.Render())
 			}
 		}
+	}
+
+	// Wrap state with mutex for thread-safe message processing
+	// Cache the MessageMap once to avoid rebuilding on every message
+	sd := newSessionData(state, s, app.MailboxSize, app.MailboxOverflow, app.RenderInterval, app.PingInterval)
+	s.Set(melodySessionDataKey, sd)
+
+	// This is a fresh session, so the client should only replay messages it never managed to send
+	writeHello(s, 0, false)
+}
+
+// resume finds the session data of a reconnecting tab: either held since its connection closed,
+// or still attached to its old connection.  After a network drop, the server doesn't notice the
+// old socket has gone until its pong times out, by which time the tab has long since reconnected.
+// The old connection is closed, and detached first, so that it isn't held when it disconnects.
+func (app *Application) resume(s *melody.Session) (*sessionData, bool) {
+	key := suspendedKey(s.Request)
+	if key == "" {
+		return nil, false
+	}
+
+	sessions, _ := app.Melody.Sessions()
+	for _, old := range sessions {
+		if old == s || suspendedKey(old.Request) != key {
+			continue
+		}
 
-		// Wrap state with mutex for thread-safe message processing
-		// Cache the MessageMap once to avoid rebuilding on every message
-		sd := &sessionData{
-			state:      state,
-			messageMap: state.Update(),
+		sdRaw, exists := old.Get(melodySessionDataKey)
+		if !exists || sdRaw.(*sessionData).stopped() {
+			continue
 		}
-		s.Set(melodySessionDataKey, sd)
+		sd := sdRaw.(*sessionData)
+
+		// Messages keep being processed until the new connection is attached
+		sd.mu.Lock()
+		sd.held = true
+		sd.mu.Unlock()
+
+		old.UnSet(melodySessionDataKey)
+		old.Close()
+
+		// The old connection may have disconnected just before it was detached
+		if held, ok := app.suspended.resume(key); ok && held != sd {
+			held.stop()
+		}
+
+		return sd, true
 	}
+
+	return app.suspended.resume(key)
+}
+
+// resumeSession attaches held session data to the new connection of a reconnecting tab,
+// and sends a render, since the state may have moved on while the tab was disconnected
+func (app *Application) resumeSession(s *melody.Session, sd *sessionData, startingRoute string) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	sd.session = s
+	sd.held = false
+
+	if sd.state.GetRoute() != startingRoute {
+		if newRoute := changeRoute(sd.state, startingRoute); newRoute != startingRoute {
+			writeReplaceRoute(s, newRoute)
+		}
+	}
+
+	s.Set(melodySessionDataKey, sd)
+	sd.renderSafely(s)
+
+	// Let the client know which of its queued messages we have already processed
+	writeHello(s, sd.lastSeq, true)
+}
+
+// onDisconnect is the Melody handler that is called when a connection closes.
+// The session data is held for the grace period, so the tab can resume if it reconnects.
+func (app *Application) onDisconnect(s *melody.Session) {
+	sdRaw, exists := s.Get(melodySessionDataKey)
+	if !exists {
+		return
+	}
+	sd := sdRaw.(*sessionData)
+
+	// A session stopped by its overflow policy is discarded, not held
+	key := suspendedKey(s.Request)
+	if app.DisconnectGracePeriod <= 0 || key == "" || sd.stopped() {
+		sd.stop()
+		return
+	}
+
+	app.suspended.hold(key, sd, app.DisconnectGracePeriod)
 }
 
 // MESSAGE HANDLING
@@ -197,6 +220,16 @@ type Message struct {
 	Identifier    string `json:"identifier"`
 	BlockRerender bool   `json:"blockRerender"`
 	ComponentID   string `json:"componentId,omitempty"`
+
+	// Seq is set by gotea.js, and numbers messages so replays after a reconnect can be deduplicated
+	Seq uint64 `json:"seq,omitempty"`
+
+	// CallID is set by gotea.call, and is used to send the reply back to the right Promise
+	CallID uint64 `json:"callId,omitempty"`
+
+	// timerKey and timerGeneration identify the keyed timer that delivered the message, if any
+	timerKey        string
+	timerGeneration uint64
 }
 
 // Some helpers for decoding messages
@@ -252,6 +285,39 @@ type Response struct {
 	NextMsg *Message
 	Delay   time.Duration
 	Error   error
+
+	// replaceRoute is set by the router when a guard redirects,
+	// so the browser's URL can be updated to match
+	replaceRoute string
+
+	// timers are the keyed timers to start, replace or cancel
+	timers []timerCommand
+
+	// patches replace individual elements instead of rerendering the whole state
+	patches []patch
+
+	// commands are for gotea.js to carry out once the render has been applied
+	commands []clientCommand
+
+	// events carry data to JS in the browser
+	events []clientEvent
+
+	// skipRender is set for responses which only send events or replies
+	skipRender bool
+
+	// reply is the payload sent back to gotea.call
+	reply any
+}
+
+// patch is the replacement for the element with the ID
+type patch struct {
+	id   string
+	html []byte
+}
+
+// appendCopy appends the items to a copy of the slice, leaving the original alone
+func appendCopy[T any](slice []T, items ...T) []T {
+	return append(append([]T{}, slice...), items...)
 }
 
 // Here are a bunch of helper functions to create Responses
@@ -288,6 +354,18 @@ func RespondWithDelayedNextMsg(message Message, delay time.Duration) Response {
 	}
 }
 
+// RespondWithPatch responds by replacing just the element with the ID, rather than rerendering the whole state.
+// The element should be rendered with the same ID, e.g. using ComponentID.UniqueID, so that it can be patched again.
+func RespondWithPatch(id string, el h.Element) Response {
+	return Respond().WithPatch(id, el)
+}
+
+// WithPatch adds an element replacement to a response.  Several elements can be patched at once.
+func (r Response) WithPatch(id string, el h.Element) Response {
+	r.patches = appendCopy(r.patches, patch{id: id, html: el.Bytes()})
+	return r
+}
+
 // MessageHandler functions are the functions that are called when a message is received.
 // Typically they would be used to make some sort of mutation to the state.
 // They can also return a new message to be processed, and optionally a delay.
@@ -315,37 +393,84 @@ func MergeMaps(msgMaps ...MessageMap) MessageMap {
 // handleMessage is the Melody handler that is called when a websocket message is received
 // In gotea, all it does is retrieve the state from the session, and then pass the message processor
 func handleMessage(s *melody.Session, msg []byte) {
-	sdRaw, _ := s.Get(melodySessionDataKey)
+	sdRaw, exists := s.Get(melodySessionDataKey)
+	if !exists {
+		// e.g. a client with a mismatched protocol version, which has been told to reload
+		return
+	}
 	sd := sdRaw.(*sessionData)
 
 	var message Message
 	if err := json.Unmarshal(msg, &message); err != nil {
-		s.Write(sd.state.RenderError(err))
+		sd.renderError(err)
 		return
 	}
 
-	if err := message.process(s, sd); err != nil {
-		s.Write(sd.state.RenderError(err))
+	// Pongs measure the connection, so they don't wait in the mailbox
+	if message.Message == pongMessage {
+		var pingID uint64
+		message.MustDecodeArgs(&pingID)
+		sd.pong(pingID)
 		return
 	}
+
+	// Messages replayed by the client after a reconnect may already have been processed.
+	// One that is still waiting in the mailbox is acknowledged in turn, so needs no reply.
+	if accepted, processed := sd.acceptSeq(message.Seq); !accepted {
+		if processed {
+			sd.drop(message, errAlreadyProcessed)
+		}
+		return
+	}
+
+	// The message joins the back of the session's mailbox, to be processed in turn
+	sd.enqueue(message)
 }
 
-// process does the actual work of dealing with an incoming message.
+// onSent is the Melody handler that is called once a frame has been sent to the client
+func onSent(s *melody.Session, _ []byte) {
+	remaining := frameDone(s)
+	if sdRaw, exists := s.Get(melodySessionDataKey); exists {
+		sdRaw.(*sessionData).frameSent(remaining)
+	}
+}
+
+// onError is the Melody handler for connection errors.
+// A frame melody couldn't queue will never be sent, so it no longer counts as unsent.
+func onError(s *melody.Session, err error) {
+	if errors.Is(err, melody.ErrMessageBufferFull) || errors.Is(err, melody.ErrWriteClosed) {
+		log.Printf("Frame not sent: %v", err)
+		onSent(s, nil)
+	}
+}
+
+// process does the actual work of dealing with an incoming message, and is only ever
+// called from the session's own goroutine, so messages are processed one at a time.
 // It checks to make sure a message handling function is assigned to that message, raising an error if not.
 // Assuming a message handling function is found, it is executed and the new state is rendered
-// Any further messages are sent for processing in the same way (recursively).
-func (message Message) process(s *melody.Session, sd *sessionData) error {
+// Any further messages are queued in the session mailbox to be processed in the same way.
+func (message Message) process(sd *sessionData) error {
+	// The lock guards the state and connection against the runtime outside
+	// the message loop, e.g. a disconnected tab being resumed
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	// A message from a keyed timer is dropped if the timer has been cancelled or replaced since it fired.
+	// It is claimed before anything else, so a message rejected below doesn't leave its timer pending.
+	if message.timerKey != "" && !sd.claimTimer(&message) {
+		return nil
+	}
+
 	// Since messages can trigger themselves, they can potentially set off an infinite loop,
 	// which would not be interrupted by the connection closing.
 	// So here we check that the connection is open before processing the message.
-	if s.IsClosed() {
+	// Sessions held for a disconnected tab keep processing (without being able to render)
+	// until the tab resumes or the grace period runs out.
+	s := sd.session
+	if s.IsClosed() && !sd.held {
 		return fmt.Errorf("Could not process message %s: connection has been closed", message.Message)
 	}
 
-	// Lock the session mutex to prevent concurrent state mutation
-	sd.mu.Lock()
-	defer sd.mu.Unlock()
-
 	state := sd.state
 
 	// Try system messages first.
@@ -369,36 +494,39 @@ func (message Message) process(s *melody.Session, sd *sessionData) error {
 		return response.Error
 	}
 
-	// Now we can render the new state
-	if !message.BlockRerender {
-		s.Write(state.Render())
+	if response.replaceRoute != "" {
+		writeReplaceRoute(s, response.replaceRoute)
+	}
 
-		// If state is persistable, send snapshot to client
-		if persistable, ok := state.(Persistable); ok {
-			if snapshot, err := persistable.Serialize(); err == nil {
-				// Send special system message to client with state snapshot
-				stateMsg := map[string]interface{}{
-					"type": "STATE_SNAPSHOT",
-					"data": string(snapshot),
-				}
-				if jsonMsg, err := json.Marshal(stateMsg); err == nil {
-					s.Write(jsonMsg)
-				}
-			}
+	// Every call gets a reply, even if the handler has nothing to say, so its Promise resolves
+	if message.CallID != 0 {
+		sd.requestReply(message.CallID, response.reply)
+	}
+
+	sd.applyTimers(response.timers)
+
+	// Now we can mark the state for rendering.
+	// Renders are coalesced, so a burst of messages results in a single render.
+	if !message.BlockRerender {
+		if len(response.patches) > 0 {
+			sd.requestPatches(response.patches)
+		} else if !response.skipRender {
+			sd.requestRender()
 		}
 	}
 
-	// If there is a next message, we process it
-	// Note: this must happen in a go routine to unblock this session from receiving further messages
-	// The goroutine will acquire the lock when it's ready to process
-	if response.NextMsg != nil {
-		go func() {
-			if response.Delay > 0 {
-				time.Sleep(response.Delay)
-			}
+	// Commands and events are sent even if rerendering is blocked
+	if len(response.commands) > 0 {
+		sd.requestCommands(response.commands)
+	}
+	if len(response.events) > 0 {
+		sd.requestEvents(response.events)
+	}
 
-			response.NextMsg.process(s, sd)
-		}()
+	// If there is a next message, it is queued behind anything already in the mailbox.
+	// By the time it is processed, it will render to whichever connection is attached to the session.
+	if response.NextMsg != nil {
+		sd.enqueueAfter(*response.NextMsg, response.Delay)
 	}
 
 	return nil
@@ -412,6 +540,34 @@ func (message Message) process(s *melody.Session, sd *sessionData) error {
 type Application struct {
 	*melody.Melody
 	Model State
+
+	// HandoffTTL is how long the state rendered for the initial HTTP request is kept
+	// waiting for its websocket connection to adopt it
+	HandoffTTL time.Duration
+
+	// HandoffLimit is the most rendered states kept waiting at once.  Past it, pages are
+	// rendered without a handoff token and their sessions start from Init.  Zero means no limit.
+	HandoffLimit int
+
+	// DisconnectGracePeriod is how long the session of a disconnected tab is kept,
+	// so that it can resume if it reconnects.  Set to zero to discard sessions immediately.
+	DisconnectGracePeriod time.Duration
+
+	// MailboxSize is the number of messages that can be queued for each session,
+	// and MailboxOverflow decides what happens to messages once it is full
+	MailboxSize     int
+	MailboxOverflow OverflowPolicy
+
+	// RenderInterval caps how often each session is rendered.  Messages arriving within
+	// the interval are all processed, but the state is only rendered once at the end of it.
+	RenderInterval time.Duration
+
+	// PingInterval is how often each connection is pinged to measure its latency,
+	// which is kept up to date in states that embed Connection.  Set to zero to turn pinging off.
+	PingInterval time.Duration
+
+	handoffs  *handoffStore
+	suspended *suspendedStore
 }
 
 // NewApp is used by the calling application to set up a new gotea app
@@ -420,13 +576,28 @@ type Application struct {
 func NewApp(model State) *Application {
 	melody := melody.New()
 	melody.Upgrader.EnableCompression = true
-	melody.HandleConnect(onConnect(model))
-	melody.HandleMessage(handleMessage)
 
-	return &Application{
-		Melody: melody,
-		Model:  model,
+	app := &Application{
+		Melody:                melody,
+		Model:                 model,
+		HandoffTTL:            defaultHandoffTTL,
+		HandoffLimit:          defaultHandoffLimit,
+		DisconnectGracePeriod: defaultDisconnectGracePeriod,
+		MailboxSize:           defaultMailboxSize,
+		MailboxOverflow:       OverflowBlock,
+		RenderInterval:        defaultRenderInterval,
+		PingInterval:          defaultPingInterval,
+		handoffs:              newHandoffStore(),
+		suspended:             newSuspendedStore(),
 	}
+
+	melody.HandleConnect(app.onConnect)
+	melody.HandleDisconnect(app.onDisconnect)
+	melody.HandleMessage(handleMessage)
+	melody.HandleSentMessage(onSent)
+	melody.HandleError(onError)
+
+	return app
 }
 
 // Starts the application on a specified port
@@ -442,42 +613,109 @@ func (app *Application) Start(port int, staticDirectory string) {
 	fs := http.FileServer(http.Dir(staticDirectory))
 	http.Handle(staticDirectoryWithBothSlashes, http.StripPrefix(staticDirectoryWithBothSlashes, fs))
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// Check for session cookie
-		cookie, err := r.Cookie("session_id")
-		var sessionID string
-		if err != nil || cookie.Value == "" {
-			// Create a new session ID if not present
-			sessionID = uuid.New().String()
-			http.SetCookie(w, &http.Cookie{
-				Name:    "session_id",
-				Value:   sessionID,
-				Expires: time.Now().Add(24 * time.Hour),
-			})
-			log.Printf("New session created with ID: %s", sessionID)
-		} else {
-			sessionID = cookie.Value
-			log.Printf("Existing session found with ID: %s", sessionID)
-		}
-
-		state := app.Model.Init(uuid.MustParse(sessionID))
-		changeRoute(state, r.URL.Path)
-		w.Write(state.Render())
-	})
+	http.HandleFunc("/", app.handleInitialRender)
 
 	log.Printf("Starting application server on %v\n", port)
 	http.ListenAndServe(fmt.Sprintf(":%v", port), nil)
 }
 
+// handleInitialRender serves the first, static render of a page, before the websocket takes over.
+// Route handlers can report a status code, headers or a canonical route (see RouteStatus)
+// so that crawlers and monitoring see the same response a traditional server would give.
+func (app *Application) handleInitialRender(w http.ResponseWriter, r *http.Request) {
+	// Check for session cookie
+	cookie, err := r.Cookie(sessionCookieName)
+	var sessionID string
+	if err != nil || cookie.Value == "" {
+		// Create a new session ID if not present
+		sessionID = uuid.New().String()
+		http.SetCookie(w, &http.Cookie{
+			Name:    sessionCookieName,
+			Value:   sessionID,
+			Expires: time.Now().Add(24 * time.Hour),
+		})
+		log.Printf("New session created with ID: %s", sessionID)
+	} else {
+		sessionID = cookie.Value
+		log.Printf("Existing session found with ID: %s", sessionID)
+	}
+
+	state := app.Model.Init(uuid.MustParse(sessionID))
+	newRoute := changeRoute(state, r.URL.Path)
+	if newRoute != r.URL.Path {
+		http.Redirect(w, r, newRoute, http.StatusFound)
+		return
+	}
+
+	body := state.Render()
+	status := http.StatusOK
+
+	if responder, ok := state.(httpResponder); ok {
+		routeStatus := responder.HTTPStatus()
+
+		if routeStatus.Canonical != "" && routeStatus.Canonical != r.URL.Path {
+			canonical := routeStatus.Canonical
+			if r.URL.RawQuery != "" {
+				canonical += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, canonical, http.StatusMovedPermanently)
+			return
+		}
+
+		for key, values := range routeStatus.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+
+		switch {
+		case routeStatus.Code != 0:
+			status = routeStatus.Code
+		case responder.hasRoutes() && !responder.HasRoute(newRoute):
+			status = http.StatusNotFound
+		case !state.CheckRoute(state, newRoute).allowed():
+			status = http.StatusForbidden
+		}
+	}
+
+	if w.Header().Get(contentTypeHeader) == "" {
+		w.Header().Set(contentTypeHeader, contentTypeHTML)
+	}
+
+	// Park the state we just rendered, so the websocket connection can adopt it
+	// instead of calling Init and rerunning the routing a second time
+	if token, ok := app.handoffs.park(sessionID, state, app.HandoffTTL, app.HandoffLimit); ok {
+		body = injectHandoffToken(body, token)
+	}
+
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// QueueDepths returns the number of messages waiting in the mailbox of each connected session.
+// Sessions which are consistently backed up are a sign of slow handlers or a flood of messages.
+func (app *Application) QueueDepths() []int {
+	var depths []int
+
+	sessions, _ := app.Melody.Sessions()
+	for _, s := range sessions {
+		if sdRaw, exists := s.Get(melodySessionDataKey); exists {
+			depths = append(depths, sdRaw.(*sessionData).queueDepth())
+		}
+	}
+
+	return depths
+}
+
 // Broadcast rerenders all sessions
-// Note: We don't acquire locks here because Broadcast is typically called from
-// within a message handler that already holds the lock for the current session.
-// The brief window of potential inconsistency during render is acceptable.
+// Note: Broadcast is typically called from within a message handler, so rather than
+// rendering other sessions directly, it asks each of them to render on its own goroutine.
+// Renders are coalesced, so a flurry of broadcasts won't flood slow clients.
 func (app *Application) Broadcast() {
 	sessions, _ := app.Melody.Sessions()
 	for _, s := range sessions {
-		sdRaw, _ := s.Get(melodySessionDataKey)
-		sd := sdRaw.(*sessionData)
-		s.Write(sd.state.Render())
+		if sdRaw, exists := s.Get(melodySessionDataKey); exists {
+			sdRaw.(*sessionData).requestRender()
+		}
 	}
 }
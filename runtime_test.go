@@ -0,0 +1,635 @@
+package gotea
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	a "github.com/jpincas/go-tea/attributes"
+	h "github.com/jpincas/go-tea/html"
+)
+
+func TestInitialRenderStatus(t *testing.T) {
+	testCases := []struct {
+		name             string
+		path             string
+		loggedIn         bool
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{"ok", "/", false, http.StatusOK, ""},
+		{"not found", "/nothing", false, http.StatusNotFound, ""},
+		{"guard redirects", "/account/settings", false, http.StatusFound, "/login"},
+		{"guard forbids", "/account/admin/users", true, http.StatusForbidden, ""},
+		{"handler sets status", "/teapot", false, http.StatusTeapot, ""},
+		{"canonical redirect", "/old-settings", true, http.StatusMovedPermanently, "/account/settings"},
+		{"canonical redirect keeps query", "/old-settings?tab=2", true, http.StatusMovedPermanently, "/account/settings?tab=2"},
+		{"canonical path with query", "/settings?tab=2", false, http.StatusOK, ""},
+	}
+
+	for _, testCase := range testCases {
+		m := newTestRouterModel()
+		m.LoggedIn = testCase.loggedIn
+		m.Register("/teapot", func(s State) []byte {
+			s.(*testModel).SetStatus(http.StatusTeapot)
+			s.(*testModel).SetHeader("X-Brew", "earl-grey")
+			return []byte("short and stout")
+		})
+		m.Register("/old-settings", func(s State) []byte {
+			s.(*testModel).SetCanonical("/account/settings")
+			return []byte("settings")
+		})
+		m.Register("/settings", func(s State) []byte {
+			s.(*testModel).SetCanonical("/settings")
+			return []byte("settings")
+		})
+
+		app := NewApp(m)
+		recorder := httptest.NewRecorder()
+		app.handleInitialRender(recorder, httptest.NewRequest(http.MethodGet, testCase.path, nil))
+
+		if recorder.Code != testCase.expectedStatus {
+			t.Errorf("Test '%s' failed. Expected status %d, got %d", testCase.name, testCase.expectedStatus, recorder.Code)
+		}
+
+		if location := recorder.Header().Get("Location"); location != testCase.expectedLocation {
+			t.Errorf("Test '%s' failed. Expected location %s, got %s", testCase.name, testCase.expectedLocation, location)
+		}
+
+		if recorder.Code == http.StatusOK && recorder.Header().Get(contentTypeHeader) != contentTypeHTML {
+			t.Errorf("Test '%s' failed. Expected content type to be set", testCase.name)
+		}
+
+		if testCase.expectedStatus == http.StatusTeapot && recorder.Header().Get("X-Brew") != "earl-grey" {
+			t.Errorf("Test '%s' failed. Expected header set by handler", testCase.name)
+		}
+	}
+}
+
+func TestInitialRenderStatusWithoutRoutes(t *testing.T) {
+	// An app which routes by hand in OnRouteChange registers nothing, so no route can be known to be missing
+	app := NewApp(&testModel{})
+	recorder := httptest.NewRecorder()
+	app.handleInitialRender(recorder, httptest.NewRequest(http.MethodGet, "/anything", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status %d for an app without registered routes, got %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestRouteStatusResetOnRouteChange(t *testing.T) {
+	m := newTestRouterModel()
+	m.Register("/teapot", func(s State) []byte {
+		s.(*testModel).SetStatus(http.StatusTeapot)
+		s.(*testModel).SetHeader("X-Brew", "earl-grey")
+		return []byte("short and stout")
+	})
+
+	changeRoute(m, "/teapot")
+	m.Render()
+	changeRoute(m, "/")
+
+	if status := m.HTTPStatus(); status.Code != 0 || status.Header != nil || status.Canonical != "" {
+		t.Errorf("Expected status to be reset on route change, got %v", status)
+	}
+}
+
+func TestResumeAfterDisconnect(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{tab: "tab1"})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	readTestFrameUntil(t, conn, "2")
+	conn.Close()
+
+	// Wait for the server to notice the disconnect and hold the session
+	time.Sleep(100 * time.Millisecond)
+
+	// The same tab reconnecting resumes where it left off
+	_, conn = newTestConn(t, testConnOptions{server: server, tab: "tab1", skipHandshake: true})
+	if frame := readTestFrame(t, conn); frame != "2" {
+		t.Errorf("Expected resumed session to render 2, got %s", frame)
+	}
+
+	// A different tab starts afresh
+	_, other := newTestConn(t, testConnOptions{server: server, tab: "tab2"})
+	sendTestMessage(t, other, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, other); frame != "1" {
+		t.Errorf("Expected new tab to start from Init, got %s", frame)
+	}
+}
+
+func TestResumeFromLiveConnection(t *testing.T) {
+	server, old := newTestConn(t, testConnOptions{tab: "tab1"})
+	sendTestMessage(t, old, Message{Message: "INCREMENT"})
+	readTestFrame(t, old)
+
+	// After a network drop, the tab reconnects before the server notices its old socket has gone
+	_, conn := newTestConn(t, testConnOptions{server: server, tab: "tab1", skipHandshake: true})
+	if frame := readTestFrame(t, conn); frame != "1" {
+		t.Errorf("Expected session to be taken over from the old connection, got %s", frame)
+	}
+
+	old.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		if _, _, err := old.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	// The old connection closing must not hold, and later discard, the session it gave up
+	time.Sleep(100 * time.Millisecond)
+	if _, held := server.app.suspended.resume(testSessionID + ":tab1"); held {
+		t.Errorf("Expected the old connection not to hold the session")
+	}
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, conn); frame != "2" {
+		t.Errorf("Expected taken over session to carry on, got %s", frame)
+	}
+}
+
+func TestNoResumeAfterGracePeriod(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.DisconnectGracePeriod = 50 * time.Millisecond
+	server, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app), tab: "tab1"})
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	readTestFrame(t, conn)
+	conn.Close()
+
+	time.Sleep(200 * time.Millisecond)
+
+	_, conn = newTestConn(t, testConnOptions{server: server, tab: "tab1"})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, conn); frame != "1" {
+		t.Errorf("Expected session to start from Init after the grace period, got %s", frame)
+	}
+}
+
+func TestNoResumeAfterOverflowDisconnect(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.MailboxSize = 1
+	app.MailboxOverflow = OverflowDisconnect
+	server, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app), tab: "tab1"})
+	sd := testSessionData(t, server)
+
+	// Hold up the message loop on the first message, so the third overflows the mailbox
+	sd.mu.Lock()
+	for i := 0; i < 3; i++ {
+		sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	}
+	time.Sleep(50 * time.Millisecond)
+	sd.mu.Unlock()
+	time.Sleep(100 * time.Millisecond)
+
+	// The session was discarded, so the tab starts afresh
+	_, conn = newTestConn(t, testConnOptions{server: server, tab: "tab1"})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, conn); frame != "1" {
+		t.Errorf("Expected session to start from Init after an overflow disconnect, got %s", frame)
+	}
+}
+
+func TestReplayedMessagesAreDeduplicated(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{tab: "tab1", skipHandshake: true})
+	if sync := readTestFrameOfType(t, conn, frameHello); sync["lastSeq"] != float64(0) || sync["resumed"] != false {
+		t.Errorf("Expected fresh session to sync from 0, got %v", sync)
+	}
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 1})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 2})
+	readTestFrameUntil(t, conn, "2")
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	_, conn = newTestConn(t, testConnOptions{server: server, tab: "tab1", skipHandshake: true})
+	if sync := readTestFrameOfType(t, conn, frameHello); sync["lastSeq"] != float64(2) || sync["resumed"] != true {
+		t.Errorf("Expected resumed session to sync from 2, got %v", sync)
+	}
+
+	// The client replays its whole outbox - only the message that never arrived should count
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 2})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 3})
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameDrop || frame["seq"] != float64(2) {
+		t.Errorf("Expected duplicate to be reported as dropped, got %v", frame)
+	}
+	if frame := readTestFrame(t, conn); frame != "3" {
+		t.Errorf("Expected duplicate to be ignored and counter to render 3, got %s", frame)
+	}
+}
+
+func TestResumeFromFreshPage(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{tab: "tab1"})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 1})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 2})
+	readTestFrameUntil(t, conn, "2")
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	// A reloaded page keeps its tab, so resumes the session, but has an empty outbox.
+	// It carries on numbering from the server's lastSeq rather than starting again from 1.
+	_, conn = newTestConn(t, testConnOptions{server: server, tab: "tab1", skipHandshake: true})
+	sync := readTestFrameOfType(t, conn, frameHello)
+	if sync["resumed"] != true {
+		t.Fatalf("Expected reloaded page to resume the session, got %v", sync)
+	}
+
+	nextSeq := uint64(sync["lastSeq"].(float64)) + 1
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: nextSeq})
+	if frame := readTestFrame(t, conn); frame != "3" {
+		t.Errorf("Expected the fresh page's first message to be processed, got %s", frame)
+	}
+}
+
+func TestMessagesProcessedInOrder(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{route: "/log"})
+
+	// A burst of user input should be interleaved with delayed messages strictly in order of arrival
+	sendTestMessage(t, conn, Message{Message: "APPEND_LATER", Arguments: "delayed"})
+	for _, n := range []string{"1", "2", "3", "4", "5"} {
+		sendTestMessage(t, conn, Message{Message: "APPEND", Arguments: n, BlockRerender: true})
+	}
+
+	var frame string
+	for !strings.Contains(frame, "delayed") {
+		frame = readTestFrame(t, conn)
+	}
+
+	if frame != "1,2,3,4,5,delayed" {
+		t.Errorf("Expected messages to be processed in order, got %s", frame)
+	}
+}
+
+func TestPanicInHandlerRendersError(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	sendTestMessage(t, conn, Message{Message: "PANIC"})
+	if frame := readTestFrame(t, conn); !strings.HasPrefix(frame, "error:") {
+		t.Errorf("Expected error to be rendered, got %s", frame)
+	}
+
+	// The session carries on processing messages afterwards
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, conn); frame != "1" {
+		t.Errorf("Expected session to survive the panic, got %s", frame)
+	}
+}
+
+func TestPanicInRenderRendersError(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{route: "/panic"})
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, conn); !strings.HasPrefix(frame, "error:") {
+		t.Errorf("Expected error to be rendered, got %s", frame)
+	}
+
+	// Broadcasts render on the session's own goroutine too, and the server carries on
+	server.app.Broadcast()
+	if frame := readTestFrame(t, conn); !strings.HasPrefix(frame, "error:") {
+		t.Errorf("Expected error to be rendered on broadcast, got %s", frame)
+	}
+
+	_, other := newTestConn(t, testConnOptions{server: server})
+	sendTestMessage(t, other, Message{Message: "INCREMENT"})
+	if frame := readTestFrame(t, other); frame != "1" {
+		t.Errorf("Expected server to survive the panic, got %s", frame)
+	}
+}
+
+func TestRendersAreCoalesced(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.RenderInterval = 200 * time.Millisecond
+	_, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app)})
+
+	for i := 0; i < 20; i++ {
+		sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	}
+
+	// The first message may render straight away, but the rest of the burst
+	// lands within the render interval, so is folded into a single render
+	if renders := readTestFrameUntil(t, conn, "20"); renders > 2 {
+		t.Errorf("Expected burst of messages to be coalesced into at most 2 renders, got %d", renders)
+	}
+
+	// Renders are capped to one per interval
+	start := time.Now()
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	readTestFrameUntil(t, conn, "21")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Expected render to wait for the render interval, but it came after %s", elapsed)
+	}
+}
+
+func TestPatchSkipsFullRender(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.RenderInterval = 100 * time.Millisecond
+	_, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app)})
+
+	sendTestMessage(t, conn, Message{Message: "PATCH"})
+	sendTestMessage(t, conn, Message{Message: "PATCH"})
+
+	// The element is patched, and the page isn't rerendered
+	expected := h.Span(a.Attrs(a.Id("counter")), h.Text("2")).String()
+	for {
+		frame := readTestEnvelope(t, conn)
+		if frame["t"] == frameRender {
+			t.Fatalf("Expected patch instead of full render, got %v", frame)
+		}
+		if frame["t"] == framePatch && frame["id"] == "counter" && frame["html"] == expected {
+			break
+		}
+	}
+
+	// A full render supersedes any pending patches
+	sendTestMessage(t, conn, Message{Message: "PATCH"})
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+	if frame := readTestFrameOfType(t, conn, frameRender); frame["html"] != "4" {
+		t.Errorf("Expected full render of 4 without the patch, got %s", frame)
+	}
+}
+
+func TestProtocolVersionMismatch(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	// A client from a different deploy is told to reload, and is never given a session
+	conn := dialTestServer(t, server, "whence=/counter&v=0")
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameCmd || frame["cmd"] != cmdReload {
+		t.Errorf("Expected reload command, got %v", frame)
+	}
+	sendTestMessage(t, conn, Message{Message: "INCREMENT"})
+
+	// A client from before the envelope protocol can only render HTML
+	legacy := dialTestServer(t, server, "whence=/counter")
+	if frame := readRawTestFrame(t, legacy); !strings.Contains(frame, "reload") {
+		t.Errorf("Expected legacy client to be asked to reload, got %s", frame)
+	}
+
+	// Whereas a matching client completes the handshake
+	_, current := newTestConn(t, testConnOptions{server: server, skipHandshake: true})
+	if hello := readTestFrameOfType(t, current, frameHello); hello["v"] != float64(ProtocolVersion) {
+		t.Errorf("Expected handshake with version %d, got %v", ProtocolVersion, hello)
+	}
+}
+
+func TestCommandsFollowRender(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT_AND_FOCUS"})
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameRender || frame["html"] != "1" {
+		t.Fatalf("Expected render before commands, got %v", frame)
+	}
+
+	for _, expected := range []string{cmdFocus, cmdSetTitle} {
+		if frame := readTestEnvelope(t, conn); frame["t"] != frameCmd || frame["cmd"] != expected {
+			t.Errorf("Expected %s command, got %v", expected, frame)
+		}
+	}
+
+	// Commands are still sent when rerendering is blocked
+	sendTestMessage(t, conn, Message{Message: "INCREMENT_AND_FOCUS", BlockRerender: true})
+	frame := readTestEnvelope(t, conn)
+	if frame["t"] != frameCmd || frame["cmd"] != cmdFocus || frame["args"].(map[string]any)["id"] != "counter" {
+		t.Errorf("Expected focus command without a render, got %v", frame)
+	}
+}
+
+func TestEventToHook(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", BlockRerender: true})
+	sendTestMessage(t, conn, Message{Message: "PUSH_COUNTER", BlockRerender: true})
+
+	frame := readTestFrameOfType(t, conn, frameEvent)
+	if frame["target"] != "chart" || frame["name"] != "point" || frame["payload"] != float64(1) {
+		t.Errorf("Expected point event for chart with payload 1, got %v", frame)
+	}
+}
+
+func TestEventsWithoutRender(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{})
+
+	// An event response doesn't rerender on its own
+	sendTestMessage(t, conn, Message{Message: "EVENT"})
+	frame := readTestEnvelope(t, conn)
+	if frame["t"] != frameEvent || frame["name"] != "counted" || frame["payload"] != float64(1) {
+		t.Errorf("Expected counted event without a render, got %v", frame)
+	}
+
+	// Events can be pushed from outside a handler, to every tab of the session
+	_, other := newTestConn(t, testConnOptions{server: server, tab: "tab2"})
+	if pushed := server.app.PushEvent(uuid.MustParse(testSessionID), "notify", "done"); pushed != 2 {
+		t.Errorf("Expected event to be pushed to 2 connections, got %d", pushed)
+	}
+	for _, c := range []*websocket.Conn{conn, other} {
+		if frame := readTestFrameOfType(t, c, frameEvent); frame["name"] != "notify" || frame["payload"] != "done" {
+			t.Errorf("Expected pushed event, got %v", frame)
+		}
+	}
+
+	if pushed := server.app.PushEvent(uuid.New(), "notify", "done"); pushed != 0 {
+		t.Errorf("Expected no connections for another session, got %d", pushed)
+	}
+}
+
+func TestCallReplies(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	testCases := []struct {
+		name            string
+		message         Message
+		expectedPayload any
+		expectedError   string
+	}{
+		{"reply handler", Message{Message: "LOOKUP", Arguments: "a", CallID: 1}, []any{"a1", "a2"}, ""},
+		{"reply handler error", Message{Message: "LOOKUP", CallID: 2}, nil, "nothing to look up"},
+		{"ordinary handler", Message{Message: "INCREMENT", CallID: 3}, nil, ""},
+		{"unknown message", Message{Message: "NOTHING", CallID: 4}, nil, "Could not process message NOTHING: message does not exist"},
+	}
+
+	for _, testCase := range testCases {
+		sendTestMessage(t, conn, testCase.message)
+		frame := readTestFrameOfType(t, conn, frameReply)
+
+		if frame["id"] != float64(testCase.message.CallID) {
+			t.Errorf("Test '%s' failed. Expected reply to call %d, got %v", testCase.name, testCase.message.CallID, frame)
+		}
+		if fmt.Sprint(frame["payload"]) != fmt.Sprint(testCase.expectedPayload) {
+			t.Errorf("Test '%s' failed. Expected payload %v, got %v", testCase.name, testCase.expectedPayload, frame["payload"])
+		}
+		if errMsg, _ := frame["error"].(string); errMsg != testCase.expectedError {
+			t.Errorf("Test '%s' failed. Expected error '%s', got '%s'", testCase.name, testCase.expectedError, errMsg)
+		}
+	}
+}
+
+func TestCallReplyFollowsRender(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", CallID: 1})
+
+	// The Promise mustn't resolve before the page shows the handler's changes
+	var types []any
+	for frame := readTestEnvelope(t, conn); ; frame = readTestEnvelope(t, conn) {
+		if frame["t"] == frameRender || frame["t"] == frameReply {
+			types = append(types, frame["t"])
+		}
+		if frame["t"] == frameReply {
+			break
+		}
+	}
+
+	if fmt.Sprint(types) != fmt.Sprint([]any{frameRender, frameReply}) {
+		t.Errorf("Expected reply to be sent after the render, got %v", types)
+	}
+}
+
+func TestClientQuery(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	sendTestMessage(t, conn, Message{Message: "ASK_VIEWPORT"})
+
+	// The query is sent without a render
+	frame := readTestEnvelope(t, conn)
+	args, _ := frame["args"].(map[string]any)
+	if frame["t"] != frameCmd || frame["cmd"] != cmdQuery || args["query"] != QueryViewport || args["message"] != "VIEWPORT_RESULT" {
+		t.Errorf("Expected viewport query, got %v", frame)
+	}
+}
+
+func TestAcks(t *testing.T) {
+	_, conn := newTestConn(t, testConnOptions{})
+
+	// The ack follows the render of the message it acknowledges
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 1})
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameRender || frame["html"] != "1" {
+		t.Errorf("Expected render before ack, got %v", frame)
+	}
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameAck || frame["seq"] != float64(1) {
+		t.Errorf("Expected ack of message 1, got %v", frame)
+	}
+
+	// Messages which don't rerender, or which fail, are still acknowledged
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 2, BlockRerender: true})
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameAck || frame["seq"] != float64(2) {
+		t.Errorf("Expected ack of blocked message 2, got %v", frame)
+	}
+
+	sendTestMessage(t, conn, Message{Message: "PANIC", Seq: 3})
+	readTestFrameOfType(t, conn, frameError)
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameAck || frame["seq"] != float64(3) {
+		t.Errorf("Expected ack of failed message 3, got %v", frame)
+	}
+}
+
+func TestOverflowDropsAreReported(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.MailboxSize = 1
+	app.MailboxOverflow = OverflowDropNewest
+	server, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app)})
+	sd := testSessionData(t, server)
+
+	// Hold up the message loop on the first message, so the second fills the mailbox
+	sd.mu.Lock()
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 1})
+	time.Sleep(50 * time.Millisecond)
+	sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: 2})
+	sendTestMessage(t, conn, Message{Message: "LOOKUP", Arguments: "a", Seq: 3, CallID: 1})
+	time.Sleep(50 * time.Millisecond)
+	sd.mu.Unlock()
+
+	// Message 1 may be flushed before the drop is reported, and its ack may be merged
+	// with that of message 2, so the frames are collected without assuming their order
+	var reply, drop map[string]any
+	var acked float64
+	for reply == nil || drop == nil || acked < 2 {
+		frame := readTestEnvelope(t, conn)
+		switch frame["t"] {
+		case frameReply:
+			reply = frame
+		case frameDrop:
+			drop = frame
+		case frameAck:
+			acked = frame["seq"].(float64)
+		}
+	}
+
+	if reply["id"] != float64(1) || reply["error"] == nil {
+		t.Errorf("Expected dropped call to be rejected, got %v", reply)
+	}
+	if drop["seq"] != float64(3) {
+		t.Errorf("Expected dropped message to be reported, got %v", drop)
+	}
+	if acked != 2 {
+		t.Errorf("Expected queued messages to be acknowledged as usual, got ack of %v", acked)
+	}
+}
+
+func TestFlushWaitsForQueuedFrames(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{})
+	sd := testSessionData(t, server)
+
+	// Pretend the previous render is still waiting in melody's buffer
+	unsentFrameCounter(sd.session).Add(1)
+	for seq := uint64(1); seq <= 3; seq++ {
+		sendTestMessage(t, conn, Message{Message: "INCREMENT", Seq: seq})
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if !sd.flushHeld.Load() {
+		t.Fatalf("Expected flush to be held while the connection is backed up")
+	}
+
+	// Once it has gone, the held flush renders the latest state and acknowledges the last message
+	onSent(sd.session, nil)
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameRender || frame["html"] != "3" {
+		t.Errorf("Expected held flush to render the latest state, got %v", frame)
+	}
+	if frame := readTestEnvelope(t, conn); frame["t"] != frameAck || frame["seq"] != float64(3) {
+		t.Errorf("Expected held flush to ack message 3, got %v", frame)
+	}
+}
+
+func TestPingLatency(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.PingInterval = 50 * time.Millisecond
+	_, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app)})
+
+	ping := readTestFrameOfType(t, conn, framePing)
+	if ping["latency"] != float64(0) {
+		t.Errorf("Expected no latency before the first pong, got %v", ping["latency"])
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	sendTestMessage(t, conn, Message{Message: pongMessage, Arguments: ping["id"]})
+
+	// The first measurement changes the quality from unknown, so the state is rerendered
+	readTestFrameOfType(t, conn, frameRender)
+
+	if ping := readTestFrameOfType(t, conn, framePing); ping["latency"].(float64) < 20 {
+		t.Errorf("Expected latency of at least 20ms, got %v", ping["latency"])
+	}
+}
+
+func TestConnectionQuality(t *testing.T) {
+	testCases := []struct {
+		latency  time.Duration
+		expected ConnectionQuality
+	}{
+		{0, QualityUnknown},
+		{20 * time.Millisecond, QualityGood},
+		{200 * time.Millisecond, QualityFair},
+		{time.Second, QualityPoor},
+	}
+
+	for _, testCase := range testCases {
+		c := Connection{latency: testCase.latency}
+		if quality := c.Quality(); quality != testCase.expected {
+			t.Errorf("Expected %v latency to be %s, got %s", testCase.latency, testCase.expected, quality)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package gotea
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/olahol/melody"
+)
+
+const (
+	// defaultMailboxSize is the number of messages that can be queued for a session
+	// before the overflow policy kicks in
+	defaultMailboxSize = 64
+
+	// defaultRenderInterval caps renders at roughly one per animation frame
+	defaultRenderInterval = 16 * time.Millisecond
+)
+
+// OverflowPolicy decides what happens to a message that arrives when a session's mailbox is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for space in the mailbox.  For messages from the browser,
+	// this stops the connection being read until the session catches up.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the message that has just arrived
+	OverflowDropNewest
+	// OverflowDropOldest discards the message at the front of the mailbox to make room
+	OverflowDropOldest
+	// OverflowDisconnect closes the connection of a session that can't keep up,
+	// and discards the session rather than holding it for the tab to resume
+	OverflowDisconnect
+)
+
+// sessionData holds the state of a session, along with the mailbox through which all its
+// messages are processed.  Each session is served by a single goroutine reading the mailbox,
+// so messages - whether from the browser or delayed NextMsgs - are handled one at a time, in order.
+// It also caches the MessageMap to avoid rebuilding it on every message.
+type sessionData struct {
+	state      State
+	mu         sync.Mutex
+	messageMap MessageMap // cached from state.Update()
+
+	// session is the connection currently attached to the state.
+	// It is swapped for the new connection when a disconnected tab resumes.
+	session *melody.Session
+
+	// held is set while the connection is down but the state is being
+	// kept for the tab to resume, and messages should still be processed
+	held bool
+
+	// lastSeq is the sequence number of the last message processed, which the hello sent on
+	// reconnect reports so gotea.js replays everything after it.  receivedSeq is that of the
+	// last message received, which may still be waiting in the mailbox.  Replays at or below
+	// it are ignored, since the original is processed (and acknowledged) in turn.
+	lastSeq     uint64
+	receivedSeq uint64
+
+	mailbox  chan Message
+	overflow OverflowPolicy
+	done     chan struct{}
+	stopOnce sync.Once
+
+	// Renders are requested by marking the session dirty, and flushed by the
+	// message loop at most once per render interval
+	renderRequests chan struct{}
+	renderInterval time.Duration
+	lastRender     time.Time
+
+	// fullRender is set when the whole state needs rendering, which supersedes any pending patches.
+	// It is atomic, as other sessions set it when broadcasting, and mustn't wait for the lock.
+	fullRender     atomic.Bool
+	pendingPatches []patch
+
+	// pendingCommands, pendingEvents and pendingReplies are sent after the render they follow
+	pendingCommands []clientCommand
+	pendingReplies  []callReply
+	pendingEvents   []clientEvent
+	eventsMu        sync.Mutex
+
+	// pendingAck is the sequence number of the last message processed since the previous flush.
+	// Acknowledging it after the render tells gotea.js that the message, and all before it, are done.
+	pendingAck uint64
+
+	// flushHeld is set when a flush is held back because the connection's previous frames
+	// haven't been sent yet.  It is retried once they have, so the latest state gets through.
+	flushHeld atomic.Bool
+
+	// The connection is pinged every pingInterval, to measure its latency
+	pingInterval time.Duration
+	pingID       uint64
+	pingSentAt   time.Time
+	latency      time.Duration
+
+	// timers are the session's pending keyed timers
+	timers          map[string]*sessionTimer
+	timerGeneration uint64
+}
+
+// newSessionData sets up the session and starts the goroutine which processes its mailbox
+func newSessionData(state State, s *melody.Session, mailboxSize int, overflow OverflowPolicy, renderInterval, pingInterval time.Duration) *sessionData {
+	if mailboxSize <= 0 {
+		mailboxSize = defaultMailboxSize
+	}
+
+	sd := &sessionData{
+		state:          state,
+		messageMap:     state.Update(),
+		session:        s,
+		mailbox:        make(chan Message, mailboxSize),
+		overflow:       overflow,
+		done:           make(chan struct{}),
+		renderRequests: make(chan struct{}, 1),
+		renderInterval: renderInterval,
+		pingInterval:   pingInterval,
+	}
+
+	go sd.run()
+	return sd
+}
+
+// run is the session's message loop, which lives until the session is stopped.
+// As well as processing messages, it flushes renders: when a render is requested,
+// a flush is scheduled for the end of the current render interval, and any further
+// requests before then are folded into it.
+func (sd *sessionData) run() {
+	flushTimer := time.NewTimer(0)
+	if !flushTimer.Stop() {
+		<-flushTimer.C
+	}
+	flushPending := false
+
+	// A nil channel never delivers, so pinging can be turned off
+	var pings <-chan time.Time
+	if sd.pingInterval > 0 {
+		pingTicker := time.NewTicker(sd.pingInterval)
+		defer pingTicker.Stop()
+		pings = pingTicker.C
+	}
+
+	for {
+		select {
+		case <-sd.done:
+			flushTimer.Stop()
+			return
+
+		case message := <-sd.mailbox:
+			if err := sd.processSafely(message); err != nil {
+				// A failed call rejects its Promise, rather than replacing the page
+				if message.CallID != 0 {
+					sd.replyError(message.CallID, err)
+				} else {
+					sd.renderError(err)
+				}
+			}
+			if message.Seq != 0 {
+				sd.processedSeq(message.Seq)
+			}
+
+		case <-sd.renderRequests:
+			if !flushPending {
+				flushPending = true
+				flushTimer.Reset(sd.renderInterval - time.Since(sd.lastRender))
+			}
+
+		case <-flushTimer.C:
+			flushPending = false
+			sd.flush()
+
+		case <-pings:
+			sd.ping()
+		}
+	}
+}
+
+// requestRender marks the session as needing a render.  It never blocks,
+// so it is safe to call from anywhere, including other sessions' handlers.
+func (sd *sessionData) requestRender() {
+	sd.fullRender.Store(true)
+	sd.signalRender()
+}
+
+// requestPatches queues element replacements to be sent with the next render.
+// A later patch to the same element replaces an earlier one.
+// It must be called with the session locked.
+func (sd *sessionData) requestPatches(patches []patch) {
+	for _, p := range patches {
+		sd.pendingPatches = slices.DeleteFunc(sd.pendingPatches, func(pending patch) bool {
+			return pending.id == p.id
+		})
+		sd.pendingPatches = append(sd.pendingPatches, p)
+	}
+	sd.signalRender()
+}
+
+// processedSeq records that the message with the sequence number has been processed, and queues
+// an acknowledgement of it, to be sent after the next render.  The ack is sent even if the
+// message didn't rerender, so loading states always clear.
+func (sd *sessionData) processedSeq(seq uint64) {
+	sd.mu.Lock()
+	sd.lastSeq = seq
+	sd.pendingAck = seq
+	sd.mu.Unlock()
+
+	sd.signalRender()
+}
+
+// frameSent is called when a frame has gone out on the session's connection,
+// and retries a held flush once there is nothing left in the queue
+func (sd *sessionData) frameSent(remaining int64) {
+	if remaining <= 0 && sd.flushHeld.Load() {
+		sd.signalRender()
+	}
+}
+
+func (sd *sessionData) signalRender() {
+	select {
+	case sd.renderRequests <- struct{}{}:
+	default:
+		// A render is already requested
+	}
+}
+
+// flush renders the state to the attached connection.
+// While the previous flush is still queued, it waits rather than add to the queue: melody drops
+// frames once a connection's buffer is full, which would lose the latest render, or its ack.
+// Nothing pending is discarded, and the held flush renders whatever the state is by the time it goes.
+func (sd *sessionData) flush() {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	// Marked held before checking, so a frame sent in between still sees it and retries
+	sd.flushHeld.Store(true)
+	if !sd.session.IsClosed() && unsentFrames(sd.session) > 0 {
+		return
+	}
+	sd.flushHeld.Store(false)
+
+	sd.lastRender = time.Now()
+
+	patches := sd.pendingPatches
+	sd.pendingPatches = nil
+	commands := sd.pendingCommands
+	sd.pendingCommands = nil
+	replies := sd.pendingReplies
+	sd.pendingReplies = nil
+	events := sd.takeEvents()
+	ack := sd.pendingAck
+	sd.pendingAck = 0
+	fullRender := sd.fullRender.Swap(false)
+
+	// A held session has nowhere to render to - it will be rendered when the tab resumes
+	s := sd.session
+	if s.IsClosed() {
+		return
+	}
+
+	if fullRender {
+		sd.renderSafely(s)
+	} else {
+		for _, p := range patches {
+			writePatch(s, p)
+		}
+	}
+
+	for _, command := range commands {
+		writeCmd(s, command.name, command.args)
+	}
+
+	for _, event := range events {
+		writeEvent(s, event)
+	}
+
+	for _, reply := range replies {
+		writeReply(s, reply.callID, reply.payload, nil)
+	}
+
+	if ack != 0 {
+		writeAck(s, ack)
+	}
+
+	// If state is persistable and has been rendered, send snapshot to client
+	if persistable, ok := sd.state.(Persistable); ok && (fullRender || len(patches) > 0) {
+		if snapshot, err := persistable.Serialize(); err == nil {
+			writeSnapshot(s, snapshot)
+		}
+	}
+}
+
+// processSafely processes a message, turning a panic in a handler into an error,
+// so that one bad message doesn't bring down the session's message loop (or the server)
+func (sd *sessionData) processSafely(message Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic processing message %s: %v", message.Message, r)
+			err = fmt.Errorf("Could not process message %s: %v", message.Message, r)
+		}
+	}()
+
+	return message.process(sd)
+}
+
+// renderSafely renders the state, sending the error view instead if Render panics,
+// so that one bad render doesn't bring down the server.  It must be called with the session locked.
+func (sd *sessionData) renderSafely(s *melody.Session) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Recovered from panic rendering: %v", r)
+			writeError(s, sd.state.RenderError(fmt.Errorf("Could not render: %v", r)))
+		}
+	}()
+
+	writeRender(s, sd.state.Render())
+}
+
+// stop ends the message loop and cancels pending timers.  Anything still in the mailbox is discarded.
+func (sd *sessionData) stop() {
+	sd.stopOnce.Do(func() {
+		close(sd.done)
+		sd.stopTimers()
+	})
+}
+
+// stopped reports whether the session has been stopped, and so can't be resumed
+func (sd *sessionData) stopped() bool {
+	select {
+	case <-sd.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueue adds a message to the mailbox, applying the overflow policy if it is full.
+// It reports whether the message was queued.
+func (sd *sessionData) enqueue(message Message) bool {
+	select {
+	case sd.mailbox <- message:
+		return true
+	case <-sd.done:
+		return false
+	default:
+	}
+
+	switch sd.overflow {
+	case OverflowDropNewest:
+		log.Printf("Mailbox full, dropping message %s", message.Message)
+		sd.drop(message, errMailboxFull)
+		return false
+
+	case OverflowDropOldest:
+		// The message loop may be draining the mailbox at the same time,
+		// so only drop another message if there is still no room
+		for {
+			select {
+			case sd.mailbox <- message:
+				return true
+			default:
+			}
+
+			select {
+			case dropped := <-sd.mailbox:
+				log.Printf("Mailbox full, dropping message %s", dropped.Message)
+				sd.drop(dropped, errMailboxFull)
+			default:
+			}
+		}
+
+	case OverflowDisconnect:
+		log.Printf("Mailbox full, closing connection")
+		sd.stop()
+		sd.mu.Lock()
+		s := sd.session
+		sd.mu.Unlock()
+		s.Close()
+		return false
+
+	default:
+		select {
+		case sd.mailbox <- message:
+			return true
+		case <-sd.done:
+			return false
+		}
+	}
+}
+
+var (
+	errMailboxFull      = errors.New("Message dropped: the session's mailbox is full")
+	errAlreadyProcessed = errors.New("Message dropped: it has already been processed")
+)
+
+// drop tells the client that a message it sent won't be processed, so it stops waiting for it:
+// its loading state clears, and if it was a call, the Promise is rejected
+func (sd *sessionData) drop(message Message, reason error) {
+	// Timer messages and those from older clients have nothing waiting on them
+	if message.Seq == 0 && message.CallID == 0 {
+		return
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if message.CallID != 0 {
+		writeReply(sd.session, message.CallID, nil, reason)
+	}
+	if message.Seq != 0 {
+		writeDrop(sd.session, message.Seq)
+	}
+}
+
+// enqueueAfter adds a message to the mailbox once the delay has passed.
+// This happens off the session goroutine, so a blocking overflow policy can't deadlock it.
+func (sd *sessionData) enqueueAfter(message Message, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		sd.enqueue(message)
+	})
+}
+
+// queueDepth is the number of messages waiting to be processed
+func (sd *sessionData) queueDepth() int {
+	return len(sd.mailbox)
+}
+
+// renderError sends the error view to whichever connection is attached to the session
+func (sd *sessionData) renderError(err error) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	writeError(sd.session, sd.state.RenderError(err))
+}
+
+// acceptSeq records the sequence number of an incoming message, reporting whether it is new.
+// If it isn't, processed reports whether the original has already been processed,
+// rather than still waiting in the mailbox.
+func (sd *sessionData) acceptSeq(seq uint64) (accepted, processed bool) {
+	// Messages from older clients aren't numbered, and are always processed
+	if seq == 0 {
+		return true, false
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if seq <= sd.receivedSeq {
+		return false, seq <= sd.lastSeq
+	}
+
+	sd.receivedSeq = seq
+	return true, false
+}
@@ -0,0 +1,91 @@
+package gotea
+
+import (
+	"testing"
+)
+
+// newTestMailbox creates session data without starting its message loop,
+// so the contents of the mailbox can be inspected
+func newTestMailbox(size int, overflow OverflowPolicy) *sessionData {
+	return &sessionData{
+		mailbox:  make(chan Message, size),
+		overflow: overflow,
+		done:     make(chan struct{}),
+	}
+}
+
+func drainMailbox(sd *sessionData) (messages []string) {
+	for len(sd.mailbox) > 0 {
+		messages = append(messages, (<-sd.mailbox).Message)
+	}
+	return
+}
+
+func TestMailboxOverflow(t *testing.T) {
+	testCases := []struct {
+		name     string
+		overflow OverflowPolicy
+		expected []string
+	}{
+		{"drop newest", OverflowDropNewest, []string{"1", "2"}},
+		{"drop oldest", OverflowDropOldest, []string{"2", "3"}},
+	}
+
+	for _, testCase := range testCases {
+		sd := newTestMailbox(2, testCase.overflow)
+		sd.enqueue(Message{Message: "1"})
+		sd.enqueue(Message{Message: "2"})
+
+		if depth := sd.queueDepth(); depth != 2 {
+			t.Errorf("Test '%s' failed. Expected queue depth 2, got %d", testCase.name, depth)
+		}
+
+		sd.enqueue(Message{Message: "3"})
+
+		messages := drainMailbox(sd)
+		if len(messages) != len(testCase.expected) || messages[0] != testCase.expected[0] || messages[1] != testCase.expected[1] {
+			t.Errorf("Test '%s' failed. Expected mailbox %v, got %v", testCase.name, testCase.expected, messages)
+		}
+	}
+}
+
+func TestMailboxBlockReleasedOnStop(t *testing.T) {
+	sd := newTestMailbox(1, OverflowBlock)
+	sd.enqueue(Message{Message: "1"})
+
+	queued := make(chan bool)
+	go func() {
+		queued <- sd.enqueue(Message{Message: "2"})
+	}()
+
+	// A blocked sender must not be left hanging once the session has gone
+	sd.stop()
+	if <-queued {
+		t.Errorf("Expected message not to be queued on a stopped session")
+	}
+}
+
+func TestSeqRecordedOnceProcessed(t *testing.T) {
+	sd := newTestMailbox(2, OverflowBlock)
+
+	if accepted, _ := sd.acceptSeq(1); !accepted {
+		t.Fatalf("Expected new message to be accepted")
+	}
+
+	// Until it is processed, the message isn't reported to a reconnecting client as done,
+	// and a replay of it is ignored without being rejected
+	if sd.lastSeq != 0 {
+		t.Errorf("Expected queued message not to count as processed, got lastSeq %d", sd.lastSeq)
+	}
+	if accepted, processed := sd.acceptSeq(1); accepted || processed {
+		t.Errorf("Expected replay of queued message to be ignored, got accepted %t, processed %t", accepted, processed)
+	}
+
+	sd.processedSeq(1)
+	if sd.lastSeq != 1 {
+		t.Errorf("Expected processed message to be recorded, got lastSeq %d", sd.lastSeq)
+	}
+	if accepted, processed := sd.acceptSeq(1); accepted || !processed {
+		t.Errorf("Expected replay of processed message to be rejected, got accepted %t, processed %t", accepted, processed)
+	}
+}
@@ -0,0 +1,115 @@
+package gotea
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultDisconnectGracePeriod is how long a disconnected session is held for its tab to reconnect
+	defaultDisconnectGracePeriod = 30 * time.Second
+)
+
+// suspendedStore holds the sessions of disconnected tabs for a grace period,
+// so that a reconnecting tab can resume its exact in-memory state.
+// Sessions are keyed by the session cookie plus the per-tab ID generated by gotea.js.
+type suspendedStore struct {
+	mu   sync.Mutex
+	held map[string]suspended
+}
+
+type suspended struct {
+	sd     *sessionData
+	expiry *time.Timer
+}
+
+func newSuspendedStore() *suspendedStore {
+	return &suspendedStore{
+		held: make(map[string]suspended),
+	}
+}
+
+// hold keeps the session data until it is resumed or the grace period ends.
+// While held, delayed messages keep being processed against the state,
+// so timers are still up to date when the tab comes back.
+func (ss *suspendedStore) hold(key string, sd *sessionData, gracePeriod time.Duration) {
+	sd.mu.Lock()
+	sd.held = true
+	sd.mu.Unlock()
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	// A tab can only have one session held at a time
+	ss.release(key)
+
+	ss.held[key] = suspended{
+		sd: sd,
+		expiry: time.AfterFunc(gracePeriod, func() {
+			ss.mu.Lock()
+			defer ss.mu.Unlock()
+
+			if current, ok := ss.held[key]; ok && current.sd == sd {
+				ss.release(key)
+			}
+		}),
+	}
+}
+
+// resume takes the held session data for the key out of the store
+func (ss *suspendedStore) resume(key string) (*sessionData, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	h, ok := ss.held[key]
+	if !ok {
+		return nil, false
+	}
+
+	h.expiry.Stop()
+	delete(ss.held, key)
+	return h.sd, true
+}
+
+// discard drops any session held for the key, e.g. when the tab has reloaded
+// and started a fresh session instead
+func (ss *suspendedStore) discard(key string) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.release(key)
+}
+
+// release stops a held session for good, so that any self-perpetuating
+// message loops it was running will stop.  The store lock must be held.
+func (ss *suspendedStore) release(key string) {
+	h, ok := ss.held[key]
+	if !ok {
+		return
+	}
+
+	h.expiry.Stop()
+	delete(ss.held, key)
+
+	h.sd.mu.Lock()
+	h.sd.held = false
+	h.sd.mu.Unlock()
+	h.sd.stop()
+}
+
+// suspendedKey identifies a browser tab: the session cookie plus the tab ID that
+// gotea.js keeps in sessionStorage.  If either is missing, the session can't be held.
+func suspendedKey(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+
+	tabID := r.URL.Query().Get("tab")
+	if tabID == "" {
+		return ""
+	}
+
+	return cookie.Value + ":" + tabID
+}
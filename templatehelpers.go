@@ -1,7 +1,11 @@
 package gotea
 
 import (
+	"encoding/json"
 	"fmt"
+	"time"
+
+	a "github.com/jpincas/go-tea/attributes"
 )
 
 // These functions are intended to be used by templates
@@ -13,6 +17,10 @@ const (
 	sendMessageWithValueFuncName     = "sendMessageWithValueFromInput"
 	sendMessageWithThisValueFuncName = "sendMessageWithValueFromThisInput"
 	updateFormFuncName               = "updateFormState"
+	debounceFuncName                 = "debounce"
+	throttleFuncName                 = "throttle"
+	sendMessageWithEventFuncName     = "sendMessageWithEvent"
+	onKeyFuncName                    = "onKey"
 )
 
 func constructFuncName(funcName string) string {
@@ -78,6 +86,112 @@ func UpdateFormState(m Message, formID string) string {
 	return fmt.Sprintf(`%s(%s, "%s")`, constructFuncName(updateFormFuncName), m.toJson(), formID)
 }
 
+// Event payloads
+// These send properties of the browser event along with the message,
+// so e.g. one handler on a grid can tell which cell was clicked, from its data attributes.
+
+// EventField selects properties of the browser event to send with a message
+type EventField string
+
+const (
+	// EventKey sends the key and code of a keyboard event
+	EventKey EventField = "key"
+	// EventModifiers sends whether the alt, ctrl, shift and meta keys were held
+	EventModifiers EventField = "modifiers"
+	// EventClientCoords sends the position of a mouse event relative to the viewport
+	EventClientCoords EventField = "client"
+	// EventOffsetCoords sends the position of a mouse event relative to the target element
+	EventOffsetCoords EventField = "offset"
+	// EventDataset sends the data-* attributes of the target element
+	EventDataset EventField = "dataset"
+	// EventChecked sends whether the target checkbox or radio button is checked
+	EventChecked EventField = "checked"
+	// EventValue sends the value of the target input
+	EventValue EventField = "value"
+)
+
+// EventArgs are the arguments of a message sent with SendMessageWithEvent.
+// Only the fields which were asked for are set.
+type EventArgs struct {
+	Key      string            `json:"key"`
+	Code     string            `json:"code"`
+	AltKey   bool              `json:"altKey"`
+	CtrlKey  bool              `json:"ctrlKey"`
+	ShiftKey bool              `json:"shiftKey"`
+	MetaKey  bool              `json:"metaKey"`
+	ClientX  float64           `json:"clientX"`
+	ClientY  float64           `json:"clientY"`
+	OffsetX  float64           `json:"offsetX"`
+	OffsetY  float64           `json:"offsetY"`
+	Dataset  map[string]string `json:"dataset"`
+	Checked  bool              `json:"checked"`
+	Value    string            `json:"value"`
+
+	// Args are the arguments the message was rendered with
+	Args any `json:"args"`
+}
+
+// EventArgs decodes the arguments of a message sent with SendMessageWithEvent
+func (m Message) EventArgs() EventArgs {
+	var args EventArgs
+	m.MustDecodeArgs(&args)
+	return args
+}
+
+// SendMessageWithEvent sends the message with the selected properties of the event that triggered it.
+// The message's own args are sent alongside, and everything is decoded with Message.EventArgs.
+func SendMessageWithEvent(m Message, fields ...EventField) string {
+	if fields == nil {
+		fields = []EventField{}
+	}
+
+	jsonFields, _ := json.Marshal(fields)
+	return fmt.Sprintf(`%s(%s, event, %s)`, constructFuncName(sendMessageWithEventFuncName), m.toJson(), jsonFields)
+}
+
+// Key filters
+// These only run the wrapped JS for a particular key, optionally with modifiers, e.g. "Enter", "Escape" or "Ctrl+s".
+// Keys are matched against KeyboardEvent.key, ignoring case.  The browser's default action for a
+// matching key is prevented, since the binding is handling it.
+
+// OnKey wraps any of the above so that it only runs for the key
+func OnKey(key string, js string) string {
+	// The key is encoded, so quotes in it (e.g. "'") can't end the string or the attribute
+	jsonKey, _ := json.Marshal(key)
+	return fmt.Sprintf(`%s(event, %s, () => %s)`, constructFuncName(onKeyFuncName), escapeSingleQuotes(jsonKey), js)
+}
+
+// OnKeydown is a keydown binding which only runs for the key
+func OnKeydown(key string, js string) a.Attribute {
+	return a.OnKeydown(OnKey(key, js))
+}
+
+// OnKeyUp is a keyup binding which only runs for the key
+func OnKeyUp(key string, js string) a.Attribute {
+	return a.OnKeyUp(OnKey(key, js))
+}
+
+// Rate limiting
+// These wrap any of the above, so that gotea.js holds back messages from
+// fast-firing events.  Timing is kept per element and event type.
+
+// Debounce delays the message until the event has stopped firing for the specified time,
+// so e.g. a search box sends one message when the user pauses typing, rather than one per keystroke.
+// Values are read from inputs when the message is finally sent.
+func Debounce(delay time.Duration, js string) string {
+	return rateLimit(debounceFuncName, delay, js)
+}
+
+// Throttle sends the message at most once in the specified time.  The first event sends straight away,
+// and the last event within the time is sent once it is up, so the final value is never lost.
+func Throttle(delay time.Duration, js string) string {
+	return rateLimit(throttleFuncName, delay, js)
+}
+
+func rateLimit(funcName string, delay time.Duration, js string) string {
+	return fmt.Sprintf(`%s(this, event, %d, () => %s)`, constructFuncName(funcName), delay.Milliseconds(), js)
+}
+
 // func argsToJSON(args interface{}) string {
 // 	if _, isString := args.(string); isString {
 // 		return fmt.Sprintf(`JSON.stringify("%s")`, args)
@@ -0,0 +1,86 @@
+package gotea
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitHelpers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			"debounce",
+			Debounce(300*time.Millisecond, SendBasicMessageNoArgs("SEARCH")),
+			`gotea.debounce(this, event, 300, () => gotea.sendMessage({"message":"SEARCH","args":null,"identifier":"","blockRerender":false}))`,
+		},
+		{
+			"throttle",
+			Throttle(time.Second, SendBasicMessageWithValueFromInput("SEARCH", "search-input")),
+			`gotea.throttle(this, event, 1000, () => gotea.sendMessageWithValueFromInput({"message":"SEARCH","args":null,"identifier":"","blockRerender":false}, "search-input"))`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if testCase.output != testCase.expected {
+			t.Errorf("Test '%s' failed. Expected %s, got %s", testCase.name, testCase.expected, testCase.output)
+		}
+	}
+}
+
+func TestEventHelpers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			"event fields",
+			SendMessageWithEvent(Message{Message: "PAINT"}, EventDataset, EventModifiers),
+			`gotea.sendMessageWithEvent({"message":"PAINT","args":null,"identifier":"","blockRerender":false}, event, ["dataset","modifiers"])`,
+		},
+		{
+			"no event fields",
+			SendMessageWithEvent(Message{Message: "PAINT"}),
+			`gotea.sendMessageWithEvent({"message":"PAINT","args":null,"identifier":"","blockRerender":false}, event, [])`,
+		},
+		{
+			"key filter",
+			OnKey("Ctrl+s", SendBasicMessageNoArgs("SAVE")),
+			`gotea.onKey(event, "Ctrl+s", () => gotea.sendMessage({"message":"SAVE","args":null,"identifier":"","blockRerender":false}))`,
+		},
+		{
+			"key filter for a double quote",
+			OnKey(`"`, SendBasicMessageNoArgs("QUOTE")),
+			`gotea.onKey(event, "\"", () => gotea.sendMessage({"message":"QUOTE","args":null,"identifier":"","blockRerender":false}))`,
+		},
+		{
+			"key filter for a single quote",
+			OnKey("'", SendBasicMessageNoArgs("APOSTROPHE")),
+			`gotea.onKey(event, "\u0027", () => gotea.sendMessage({"message":"APOSTROPHE","args":null,"identifier":"","blockRerender":false}))`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		if testCase.output != testCase.expected {
+			t.Errorf("Test '%s' failed. Expected %s, got %s", testCase.name, testCase.expected, testCase.output)
+		}
+	}
+}
+
+func TestEventArgs(t *testing.T) {
+	message := Message{Arguments: map[string]any{
+		"key":     "Enter",
+		"ctrlKey": true,
+		"clientX": 10.5,
+		"dataset": map[string]any{"x": "3"},
+		"args":    "row-1",
+	}}
+
+	args := message.EventArgs()
+	if args.Key != "Enter" || !args.CtrlKey || args.ClientX != 10.5 || args.Dataset["x"] != "3" || args.Args != "row-1" {
+		t.Errorf("Event args not decoded, got %+v", args)
+	}
+}
@@ -1,10 +1,12 @@
 package tester
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/google/uuid"
 	gt "github.com/jpincas/go-tea"
+	h "github.com/jpincas/go-tea/html"
 )
 
 // TestSession holds the state of a GoTea application for testing
@@ -62,3 +64,67 @@ func (s *TestSession) Render() string {
 func (s *TestSession) GetState() gt.State {
 	return s.State
 }
+
+// routeMatcher is fulfilled by any model that embeds gt.Router
+type routeMatcher interface {
+	HasRoute(string) bool
+}
+
+// AssertHrefsResolve checks that every internal link in an element tree
+// points at a route registered on the router.
+// External links, fragments and links marked with the 'external' class are skipped,
+// as are raw elements, whose contents can't be inspected.
+func AssertHrefsResolve(t *testing.T, router routeMatcher, el h.Element) {
+	t.Helper()
+
+	for _, href := range internalHrefs(el) {
+		if !router.HasRoute(href) {
+			t.Errorf("Link to %s does not resolve to a registered route", href)
+		}
+	}
+}
+
+// AssertHrefsResolve checks that every internal link in the element tree
+// resolves to a route registered on the session's state
+func (s *TestSession) AssertHrefsResolve(el h.Element) *TestSession {
+	s.t.Helper()
+
+	router, ok := s.State.(routeMatcher)
+	if !ok {
+		s.t.Fatalf("State does not embed gt.Router")
+	}
+
+	AssertHrefsResolve(s.t, router, el)
+	return s
+}
+
+func internalHrefs(el h.Element) (hrefs []string) {
+	if el.Tag == "a" {
+		var href string
+		isExternal := false
+
+		for _, attr := range el.Attributes {
+			switch attr.Name {
+			case "href":
+				href = attr.Val
+			case "class":
+				// Mirrors the check in gotea.js, which leaves these links to the browser
+				isExternal = isExternal || strings.Contains(attr.Val, "external")
+			}
+		}
+
+		if href != "" && !isExternal && isInternalHref(href) {
+			hrefs = append(hrefs, href)
+		}
+	}
+
+	for _, child := range el.Elements {
+		hrefs = append(hrefs, internalHrefs(child)...)
+	}
+
+	return
+}
+
+func isInternalHref(href string) bool {
+	return strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//")
+}
@@ -0,0 +1,175 @@
+package gotea
+
+import (
+	"time"
+)
+
+// TIMERS
+
+// Timers are delayed messages with a key.  Unlike RespondWithDelayedNextMsg, a keyed timer
+// can be cancelled or replaced before it fires, which makes debouncing, throttling and
+// stoppable loops straightforward.  Timers belong to the session that started them,
+// and are stopped when the session ends.
+
+type timerMode int
+
+const (
+	// timerReplace cancels any pending timer with the same key and starts afresh
+	timerReplace timerMode = iota
+	// timerThrottle keeps a pending timer's deadline, but updates the message it will deliver
+	timerThrottle
+	// timerCancel stops a pending timer
+	timerCancel
+)
+
+type timerCommand struct {
+	key     string
+	mode    timerMode
+	delay   time.Duration
+	message Message
+}
+
+// sessionTimer is a pending timer.  Each timer started gets a new generation, so a timer which
+// fires just as it is cancelled or replaced can be recognised as stale and ignored.
+type sessionTimer struct {
+	timer      *time.Timer
+	message    Message
+	generation uint64
+}
+
+// RespondWithTimer responds and starts a timer which delivers the message after the delay.
+// If a timer with the same key is already pending, it is cancelled and the delay starts again -
+// so returning this from a handler for every keystroke debounces the message.
+func RespondWithTimer(key string, delay time.Duration, message Message) Response {
+	return Respond().WithTimer(key, delay, message)
+}
+
+// RespondWithThrottle responds and delivers the message after the delay, at most once per delay.
+// Calls made while a timer with the same key is pending don't move it,
+// but the latest message is the one that gets delivered.
+func RespondWithThrottle(key string, delay time.Duration, message Message) Response {
+	return Respond().withTimerCommand(timerCommand{key: key, mode: timerThrottle, delay: delay, message: message})
+}
+
+// WithTimer adds a timer to a response, replacing any pending timer with the same key
+func (r Response) WithTimer(key string, delay time.Duration, message Message) Response {
+	return r.withTimerCommand(timerCommand{key: key, mode: timerReplace, delay: delay, message: message})
+}
+
+// RespondWithCancelTimer responds and stops the pending timer with the key, if there is one
+func RespondWithCancelTimer(key string) Response {
+	return Respond().CancelTimer(key)
+}
+
+// CancelTimer stops the pending timer with the key, if there is one.
+// Its message will not be delivered, even if the timer has just fired.
+func (r Response) CancelTimer(key string) Response {
+	return r.withTimerCommand(timerCommand{key: key, mode: timerCancel})
+}
+
+func (r Response) withTimerCommand(command timerCommand) Response {
+	r.timers = appendCopy(r.timers, command)
+	return r
+}
+
+// applyTimers carries out the timer commands from a response.
+// It must be called with the session locked.
+func (sd *sessionData) applyTimers(commands []timerCommand) {
+	for _, command := range commands {
+		pending, isPending := sd.timers[command.key]
+
+		switch command.mode {
+		case timerCancel:
+			if isPending {
+				pending.timer.Stop()
+				delete(sd.timers, command.key)
+			}
+
+		case timerThrottle:
+			if isPending {
+				pending.message = command.message
+				continue
+			}
+			sd.startTimer(command)
+
+		default:
+			if isPending {
+				pending.timer.Stop()
+			}
+			sd.startTimer(command)
+		}
+	}
+}
+
+func (sd *sessionData) startTimer(command timerCommand) {
+	if sd.timers == nil {
+		sd.timers = map[string]*sessionTimer{}
+	}
+
+	sd.timerGeneration++
+	generation := sd.timerGeneration
+	key := command.key
+
+	sd.timers[key] = &sessionTimer{
+		message:    command.message,
+		generation: generation,
+		timer: time.AfterFunc(command.delay, func() {
+			// The message is only a placeholder - the one delivered is whatever
+			// the timer holds when it is processed
+			queued := sd.enqueue(Message{
+				Message:         command.message.Message,
+				timerKey:        key,
+				timerGeneration: generation,
+			})
+
+			// A message the mailbox turned away will never claim its timer, which would
+			// otherwise stay pending for good - and hold back every throttle with its key
+			if !queued {
+				sd.dropTimer(key, generation)
+			}
+		}),
+	}
+}
+
+// dropTimer removes a timer whose message won't be delivered, unless it has since been replaced
+func (sd *sessionData) dropTimer(key string, generation uint64) {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	if pending, isPending := sd.timers[key]; isPending && pending.generation == generation {
+		delete(sd.timers, key)
+	}
+}
+
+// claimTimer swaps a message from a fired timer for the one the timer holds,
+// reporting false if the timer has since been cancelled or replaced.
+// It must be called with the session locked.
+func (sd *sessionData) claimTimer(message *Message) bool {
+	pending, isPending := sd.timers[message.timerKey]
+	if !isPending || pending.generation != message.timerGeneration {
+		return false
+	}
+
+	delete(sd.timers, message.timerKey)
+	*message = pending.message
+	return true
+}
+
+// stopTimers cancels all of the session's pending timers
+func (sd *sessionData) stopTimers() {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	for key, pending := range sd.timers {
+		pending.timer.Stop()
+		delete(sd.timers, key)
+	}
+}
+
+// pendingTimers is the number of timers waiting to fire
+func (sd *sessionData) pendingTimers() int {
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	return len(sd.timers)
+}
@@ -0,0 +1,111 @@
+package gotea
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimers(t *testing.T) {
+	testCases := []struct {
+		name     string
+		messages []Message
+		expected string
+	}{
+		{
+			"debounce delivers only the last message",
+			[]Message{{Message: "DEBOUNCE", Arguments: "a"}, {Message: "DEBOUNCE", Arguments: "b"}, {Message: "DEBOUNCE", Arguments: "c"}},
+			"c",
+		},
+		{
+			"throttle delivers the latest message once",
+			[]Message{{Message: "THROTTLE", Arguments: "a"}, {Message: "THROTTLE", Arguments: "b"}, {Message: "THROTTLE", Arguments: "c"}},
+			"c",
+		},
+		{
+			"cancelled timer is not delivered",
+			[]Message{{Message: "DEBOUNCE", Arguments: "a"}, {Message: "CANCEL", Arguments: "debounce"}, {Message: "THROTTLE", Arguments: "b"}},
+			"b",
+		},
+	}
+
+	for _, testCase := range testCases {
+		_, conn := newTestConn(t, testConnOptions{route: "/log"})
+
+		for _, message := range testCase.messages {
+			message.BlockRerender = true
+			sendTestMessage(t, conn, message)
+		}
+
+		if frame := readTestFrame(t, conn); frame != testCase.expected {
+			t.Errorf("Test '%s' failed. Expected %s, got %s", testCase.name, testCase.expected, frame)
+		}
+	}
+}
+
+func TestTimersStoppedWithSession(t *testing.T) {
+	app := NewApp(newRuntimeModel())
+	app.DisconnectGracePeriod = 0
+	server, conn := newTestConn(t, testConnOptions{server: newTestServer(t, app), route: "/"})
+
+	sendTestMessage(t, conn, Message{Message: "DEBOUNCE", Arguments: "a", BlockRerender: true})
+	time.Sleep(20 * time.Millisecond)
+
+	sd := testSessionData(t, server)
+	if pending := sd.pendingTimers(); pending != 1 {
+		t.Fatalf("Expected 1 pending timer, got %d", pending)
+	}
+
+	conn.Close()
+	time.Sleep(20 * time.Millisecond)
+
+	if pending := sd.pendingTimers(); pending != 0 {
+		t.Errorf("Expected timers to be cleared on disconnect, got %d pending", pending)
+	}
+}
+
+func TestTimerDroppedWhenMailboxFull(t *testing.T) {
+	throttle := func(sd *sessionData) {
+		sd.mu.Lock()
+		defer sd.mu.Unlock()
+		sd.applyTimers([]timerCommand{{key: "throttle", mode: timerThrottle, delay: time.Millisecond, message: Message{Message: "APPEND"}}})
+	}
+
+	sd := newTestMailbox(1, OverflowDropNewest)
+	sd.enqueue(Message{Message: "BUSY"})
+
+	throttle(sd)
+	time.Sleep(20 * time.Millisecond)
+
+	// The message was dropped, so the timer mustn't be left pending
+	if pending := sd.pendingTimers(); pending != 0 {
+		t.Fatalf("Expected timer to be removed when its message was dropped, got %d pending", pending)
+	}
+
+	// The next throttle starts afresh, rather than updating a timer which will never fire
+	drainMailbox(sd)
+	throttle(sd)
+	time.Sleep(20 * time.Millisecond)
+
+	if messages := drainMailbox(sd); len(messages) != 1 || messages[0] != "APPEND" {
+		t.Errorf("Expected the next throttle to deliver its message, got %v", messages)
+	}
+}
+
+func TestTimerClaimedWhenConnectionClosed(t *testing.T) {
+	server, conn := newTestConn(t, testConnOptions{route: "/", tab: "tab1"})
+	sd := testSessionData(t, server)
+	conn.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	// Between the connection closing and the session being held, timer messages are rejected
+	sd.mu.Lock()
+	sd.held = false
+	sd.applyTimers([]timerCommand{{key: "throttle", mode: timerThrottle, delay: time.Millisecond, message: Message{Message: "APPEND"}}})
+	sd.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+
+	// Otherwise the throttle would stay pending for good once the tab resumed
+	if pending := sd.pendingTimers(); pending != 0 {
+		t.Errorf("Expected timer to be removed when its message was rejected, got %d pending", pending)
+	}
+}